@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"github.com/ali/sso-server/internal/config"
 	"github.com/ali/sso-server/internal/server"
@@ -26,6 +27,20 @@ func main() {
 
 	logger.Info("config loaded", "env", config.GetEnv())
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, os.Args[2:]); err != nil {
+			logger.Fatal("migration failed", "error", err)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		if err := runRole(cfg, os.Args[2:]); err != nil {
+			logger.Fatal("role command failed", "error", err)
+		}
+		return
+	}
+
 	srv, err := server.New(cfg)
 	if err != nil {
 		logger.Fatal("failed to create server", "error", err)
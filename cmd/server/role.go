@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/database"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+)
+
+const roleUsage = "usage: sso-server role grant|revoke <email> <role> | role list <email>"
+
+// runRole implements the `role` subcommand. It is how the first admin is
+// seeded: register the account through the API, then grant it RoleAdmin.
+func runRole(cfg *config.Config, args []string) error {
+	if len(args) < 2 {
+		return errors.New(roleUsage)
+	}
+
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repo, err := repository.New(db, cfg.Database.Driver)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	user, err := repo.Users.GetByEmail(ctx, args[1])
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("no user with email %q", args[1])
+		}
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		fmt.Println(strings.Join(user.Roles, "\n"))
+		return nil
+
+	case "grant", "revoke":
+		if len(args) < 3 {
+			return errors.New(roleUsage)
+		}
+		role := args[2]
+		if !model.ValidRole(role) {
+			return fmt.Errorf("unknown role: %q", role)
+		}
+
+		done := "granted"
+		if args[0] == "grant" {
+			if user.HasRole(role) {
+				fmt.Printf("%s already has role %s\n", user.Email, role)
+				return nil
+			}
+			user.Roles = append(user.Roles, role)
+		} else {
+			if !user.HasRole(role) {
+				fmt.Printf("%s does not have role %s\n", user.Email, role)
+				return nil
+			}
+			done = "revoked"
+			user.Roles = slices.DeleteFunc(user.Roles, func(r string) bool { return r == role })
+		}
+
+		if err := repo.Users.SetRoles(ctx, user.ID, user.Roles, time.Now().UTC()); err != nil {
+			return err
+		}
+		fmt.Printf("%s role %s for %s\n", done, role, user.Email)
+		return nil
+
+	default:
+		return errors.New(roleUsage)
+	}
+}
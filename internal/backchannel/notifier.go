@@ -0,0 +1,227 @@
+// Package backchannel implements OpenID Connect Back-Channel Logout 1.0: when
+// a user's session with a client ends, the server POSTs a signed logout token
+// to the client's backchannel_logout_uri so it can end its own session too.
+package backchannel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/token"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+)
+
+const (
+	// pollInterval is how often Run looks for retries that have become due.
+	pollInterval = 10 * time.Second
+	// batchSize caps the deliveries attempted in one pass.
+	batchSize = 100
+	// maxErrorLength caps the error kept in the delivery log.
+	maxErrorLength = 500
+	// claimMargin is added to the request timeout to get how long a claimed
+	// delivery is reserved for the instance attempting it.
+	claimMargin = time.Minute
+)
+
+// Notifier queues logout tokens for clients and delivers them in the
+// background. Deliveries are stored before they are attempted, so they
+// survive restarts and are retried with exponential backoff.
+type Notifier struct {
+	cfg    config.BackchannelLogoutConfig
+	repo   *repository.Repository
+	tokens *token.Service
+	// HTTPClient sends the logout requests. It does not follow redirects,
+	// which clients must not answer with.
+	HTTPClient *http.Client
+
+	wake chan struct{}
+}
+
+func NewNotifier(cfg config.BackchannelLogoutConfig, repo *repository.Repository, tokens *token.Service) *Notifier {
+	return &Notifier{
+		cfg:    cfg,
+		repo:   repo,
+		tokens: tokens,
+		HTTPClient: &http.Client{
+			Timeout: cfg.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake: make(chan struct{}, 1),
+	}
+}
+
+// SessionsEnded queues a logout token for every ended session that was issued
+// to a client with a backchannel_logout_uri. Browser sessions are skipped:
+// their client sessions are ended, and passed in, separately. Failures are
+// logged rather than returned, because the sessions are already gone.
+func (n *Notifier) SessionsEnded(ctx context.Context, sessions []model.Session) {
+	clients := map[uuid.UUID]*model.Client{}
+	queued := 0
+
+	for _, session := range sessions {
+		if !session.ClientID.Valid {
+			continue
+		}
+
+		client, ok := clients[session.ClientID.UUID]
+		if !ok {
+			var err error
+			client, err = n.repo.Clients.GetByID(ctx, session.ClientID.UUID)
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				logger.Error("failed to fetch client for back-channel logout", "client_id", session.ClientID.UUID, "error", err)
+			}
+			clients[session.ClientID.UUID] = client
+		}
+		if client == nil || client.BackchannelLogoutURI == "" {
+			continue
+		}
+
+		now := time.Now().UTC()
+		delivery := &model.LogoutDelivery{
+			ID:            uuid.New(),
+			ClientID:      client.ID,
+			UserID:        session.UserID,
+			SessionID:     session.ID,
+			URI:           client.BackchannelLogoutURI,
+			Status:        model.LogoutDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := n.repo.LogoutDeliveries.Create(ctx, delivery); err != nil {
+			logger.Error("failed to queue back-channel logout", "client_id", client.ID, "session_id", session.ID, "error", err)
+			continue
+		}
+		queued++
+	}
+
+	if queued > 0 {
+		select {
+		case n.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run delivers queued logout tokens until ctx is cancelled.
+func (n *Notifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := n.DeliverDue(ctx); err != nil {
+			logger.Error("back-channel logout delivery failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue claims the pending deliveries that are due, attempts them
+// concurrently, and records the outcome of each. Claiming keeps instances that
+// share the database from sending the same logout token.
+func (n *Notifier) DeliverDue(ctx context.Context) error {
+	now := time.Now().UTC()
+	deliveries, err := n.repo.LogoutDeliveries.ClaimDue(ctx, now, now.Add(n.cfg.Timeout+claimMargin), batchSize)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		wg.Add(1)
+		go func(d *model.LogoutDelivery) {
+			defer wg.Done()
+			n.deliver(ctx, d)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+	return nil
+}
+
+func (n *Notifier) deliver(ctx context.Context, d *model.LogoutDelivery) {
+	err := n.send(ctx, d)
+
+	d.Attempts++
+	d.UpdatedAt = time.Now().UTC()
+	switch {
+	case err == nil:
+		d.Status = model.LogoutDeliveryDelivered
+		d.LastError = ""
+		logger.Info("back-channel logout delivered", "client_id", d.ClientID, "session_id", d.SessionID)
+	case d.Attempts >= n.cfg.MaxAttempts:
+		d.Status = model.LogoutDeliveryFailed
+		d.LastError = truncate(err.Error())
+		logger.Warn("back-channel logout failed", "client_id", d.ClientID, "session_id", d.SessionID, "attempts", d.Attempts, "error", err)
+	default:
+		d.LastError = truncate(err.Error())
+		d.NextAttemptAt = d.UpdatedAt.Add(n.retryDelay(d.Attempts))
+		logger.Warn("back-channel logout will be retried", "client_id", d.ClientID, "session_id", d.SessionID, "attempts", d.Attempts, "error", err)
+	}
+
+	if err := n.repo.LogoutDeliveries.Update(ctx, d); err != nil {
+		logger.Error("failed to record back-channel logout delivery", "delivery_id", d.ID, "error", err)
+	}
+}
+
+// send POSTs a freshly signed logout token to the client (section 2.5). Any
+// 2xx response means the client has ended the session.
+func (n *Notifier) send(ctx context.Context, d *model.LogoutDelivery) error {
+	logoutToken, err := n.tokens.IssueLogoutToken(token.LogoutTokenParams{
+		Subject:   d.UserID.String(),
+		ClientID:  d.ClientID.String(),
+		SessionID: d.SessionID,
+	})
+	if err != nil {
+		return err
+	}
+
+	body := url.Values{"logout_token": {logoutToken}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URI, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := n.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// retryDelay doubles the retry interval after every failed attempt.
+func (n *Notifier) retryDelay(attempts int) time.Duration {
+	return n.cfg.RetryInterval << min(attempts-1, 16)
+}
+
+func truncate(s string) string {
+	if len(s) > maxErrorLength {
+		return s[:maxErrorLength]
+	}
+	return s
+}
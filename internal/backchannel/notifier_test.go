@@ -0,0 +1,295 @@
+package backchannel_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/database"
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/token"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const issuer = "https://sso.test"
+
+// receiver is a client's backchannel_logout_uri. It answers with the queued
+// statuses in turn, then with 200 OK.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	tokens   []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tokens = append(r.tokens, req.PostFormValue("logout_token"))
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.tokens...)
+}
+
+type fixture struct {
+	repo     *repository.Repository
+	keys     *keys.Manager
+	tokens   *token.Service
+	client   *model.Client
+	receiver *receiver
+}
+
+func setup(t *testing.T, statuses ...int) *fixture {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := logger.Init(logger.Config{Level: "error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Open(config.DatabaseConfig{Driver: database.DriverSQLite, DSN: t.TempDir() + "/sso.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := database.NewMigrator(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := repository.New(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	km, err := keys.NewManager(ctx, repo.SigningKeys, keys.Config{Algorithm: keys.ES256, Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recv := &receiver{statuses: statuses}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	client := &model.Client{
+		ID:                   uuid.New(),
+		Name:                 "App",
+		Type:                 model.ClientTypeConfidential,
+		AuthMethod:           model.AuthMethodClientSecretBasic,
+		RedirectURIs:         []string{"https://app.test/cb"},
+		BackchannelLogoutURI: server.URL + "/logout",
+		IsActive:             true,
+		CreatedAt:            time.Now().UTC(),
+	}
+	if err := repo.Clients.Create(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+
+	return &fixture{
+		repo:     repo,
+		keys:     km,
+		tokens:   token.NewService(config.JWTConfig{Issuer: issuer, Expiry: time.Hour}, km),
+		client:   client,
+		receiver: recv,
+	}
+}
+
+func (f *fixture) notifier(maxAttempts int, retryInterval time.Duration) *backchannel.Notifier {
+	return backchannel.NewNotifier(config.BackchannelLogoutConfig{
+		Timeout:       5 * time.Second,
+		MaxAttempts:   maxAttempts,
+		RetryInterval: retryInterval,
+	}, f.repo, f.tokens)
+}
+
+// endSession queues a logout for a new session of the client.
+func (f *fixture) endSession(t *testing.T, n *backchannel.Notifier) model.Session {
+	t.Helper()
+	session := model.Session{
+		ID:       uuid.New(),
+		UserID:   uuid.New(),
+		ClientID: uuid.NullUUID{UUID: f.client.ID, Valid: true},
+	}
+	n.SessionsEnded(context.Background(), []model.Session{session})
+	return session
+}
+
+func (f *fixture) delivery(t *testing.T) model.LogoutDelivery {
+	t.Helper()
+	deliveries, err := f.repo.LogoutDeliveries.ListByClientID(context.Background(), f.client.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("got %d deliveries, want 1", len(deliveries))
+	}
+	return deliveries[0]
+}
+
+func deliverDue(t *testing.T, n *backchannel.Notifier) {
+	t.Helper()
+	if err := n.DeliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverySendsSignedLogoutToken(t *testing.T) {
+	f := setup(t)
+	n := f.notifier(3, time.Minute)
+	session := f.endSession(t, n)
+
+	deliverDue(t, n)
+
+	received := f.receiver.received()
+	if len(received) != 1 {
+		t.Fatalf("got %d requests, want 1", len(received))
+	}
+
+	claims := &token.LogoutClaims{}
+	parsed, err := jwt.ParseWithClaims(received[0], claims, func(tok *jwt.Token) (any, error) {
+		kid, _ := tok.Header["kid"].(string)
+		key, err := f.keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public(), nil
+	}, jwt.WithValidMethods([]string{keys.ES256}), jwt.WithIssuer(issuer), jwt.WithAudience(f.client.ID.String()))
+	if err != nil {
+		t.Fatalf("logout token does not verify: %v", err)
+	}
+
+	if typ := parsed.Header["typ"]; typ != "logout+jwt" {
+		t.Errorf("typ = %v, want logout+jwt", typ)
+	}
+	if claims.Subject != session.UserID.String() {
+		t.Errorf("sub = %q, want %q", claims.Subject, session.UserID)
+	}
+	if claims.SessionID != session.ID.String() {
+		t.Errorf("sid = %q, want %q", claims.SessionID, session.ID)
+	}
+	if _, ok := claims.Events[token.BackchannelLogoutEvent]; !ok {
+		t.Errorf("events = %v, want the back-channel logout event", claims.Events)
+	}
+	if claims.ID == "" || claims.IssuedAt == nil || claims.ExpiresAt == nil {
+		t.Errorf("jti, iat and exp are required, got %+v", claims.RegisteredClaims)
+	}
+
+	d := f.delivery(t)
+	if d.Status != model.LogoutDeliveryDelivered || d.Attempts != 1 || d.LastError != "" {
+		t.Errorf("delivery = %s after %d attempts (%q), want delivered after 1", d.Status, d.Attempts, d.LastError)
+	}
+}
+
+func TestDeliveryRetriesWithBackoff(t *testing.T) {
+	f := setup(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	retryInterval := 200 * time.Millisecond
+	n := f.notifier(3, retryInterval)
+	f.endSession(t, n)
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		deliverDue(t, n)
+
+		d := f.delivery(t)
+		if d.Attempts != attempt {
+			t.Fatalf("attempts = %d, want %d", d.Attempts, attempt)
+		}
+		if !strings.Contains(d.LastError, "503") {
+			t.Errorf("last_error = %q, want the response status", d.LastError)
+		}
+		if attempt == 3 {
+			if d.Status != model.LogoutDeliveryFailed {
+				t.Fatalf("status = %s after the last attempt, want failed", d.Status)
+			}
+			break
+		}
+
+		if d.Status != model.LogoutDeliveryPending {
+			t.Fatalf("status = %s after attempt %d, want pending", d.Status, attempt)
+		}
+		want := retryInterval << (attempt - 1)
+		if got := d.NextAttemptAt.Sub(d.UpdatedAt); got != want {
+			t.Errorf("retry delay after attempt %d = %s, want %s", attempt, got, want)
+		}
+
+		// Nothing is sent before the retry is due.
+		deliverDue(t, n)
+		if got := len(f.receiver.received()); got != attempt {
+			t.Fatalf("got %d requests before the retry was due, want %d", got, attempt)
+		}
+		time.Sleep(time.Until(d.NextAttemptAt))
+	}
+
+	deliverDue(t, n)
+	if got := len(f.receiver.received()); got != 3 {
+		t.Errorf("got %d requests, want no more after the delivery failed", got)
+	}
+}
+
+func TestDeliveryIsClaimedByOneInstance(t *testing.T) {
+	f := setup(t)
+	instances := []*backchannel.Notifier{f.notifier(3, time.Minute), f.notifier(3, time.Minute)}
+	f.endSession(t, instances[0])
+
+	var wg sync.WaitGroup
+	for _, n := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := n.DeliverDue(context.Background()); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(f.receiver.received()); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+	if d := f.delivery(t); d.Attempts != 1 {
+		t.Errorf("attempts = %d, want 1", d.Attempts)
+	}
+}
+
+func TestClaimedDeliveryIsReleasedAfterLease(t *testing.T) {
+	f := setup(t)
+	f.endSession(t, f.notifier(3, time.Minute))
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	lease := now.Add(time.Minute)
+
+	claimed, err := f.repo.LogoutDeliveries.ClaimDue(ctx, now, lease, 10)
+	if err != nil || len(claimed) != 1 {
+		t.Fatalf("first claim = %d deliveries, %v; want 1", len(claimed), err)
+	}
+	if claimed, err := f.repo.LogoutDeliveries.ClaimDue(ctx, now, lease, 10); err != nil || len(claimed) != 0 {
+		t.Fatalf("second claim = %d deliveries, %v; want none while leased", len(claimed), err)
+	}
+
+	// The claiming instance never reported back.
+	later := lease.Add(time.Second)
+	if claimed, err := f.repo.LogoutDeliveries.ClaimDue(ctx, later, later.Add(time.Minute), 10); err != nil || len(claimed) != 1 {
+		t.Fatalf("claim after the lease = %d deliveries, %v; want 1", len(claimed), err)
+	}
+}
@@ -14,6 +14,7 @@ type Config struct {
 	Database DatabaseConfig
 	JWT      JWTConfig
 	OAuth    OAuthConfig
+	Session  SessionConfig
 	Log      LogConfig
 }
 
@@ -28,13 +29,53 @@ type DatabaseConfig struct {
 }
 
 type JWTConfig struct {
-	Secret        string
-	Expiry        time.Duration
-	RefreshExpiry time.Duration `mapstructure:"refresh_expiry"`
+	Issuer           string
+	Audience         []string
+	Algorithm        string
+	KeyFile          string        `mapstructure:"key_file"`
+	RotationInterval time.Duration `mapstructure:"rotation_interval"`
+	KeyRetention     time.Duration `mapstructure:"key_retention"`
+	Expiry           time.Duration
+	RefreshExpiry    time.Duration `mapstructure:"refresh_expiry"`
 }
 
+// maxAuthCodeExpiry is the longest lifetime RFC 6749 (section 4.1.2)
+// recommends for authorization codes.
+const maxAuthCodeExpiry = 10 * time.Minute
+
 type OAuthConfig struct {
-	AuthCodeExpiry time.Duration `mapstructure:"auth_code_expiry"`
+	AuthCodeExpiry     time.Duration `mapstructure:"auth_code_expiry"`
+	AllowPlainPKCE     bool          `mapstructure:"allow_plain_pkce"`
+	DeviceCodeExpiry   time.Duration `mapstructure:"device_code_expiry"`
+	DevicePollInterval time.Duration `mapstructure:"device_poll_interval"`
+	// ClientSecretGracePeriod is how long a rotated client secret keeps working.
+	ClientSecretGracePeriod time.Duration `mapstructure:"client_secret_grace_period"`
+	// Scopes are the custom API scopes, registered next to the built-in OIDC ones.
+	Scopes            []ScopeConfig
+	BackchannelLogout BackchannelLogoutConfig `mapstructure:"backchannel_logout"`
+}
+
+// BackchannelLogoutConfig configures the delivery of logout tokens to clients.
+type BackchannelLogoutConfig struct {
+	// Timeout bounds each request to a client's backchannel_logout_uri.
+	Timeout     time.Duration
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// RetryInterval is the delay before the first retry; it doubles after
+	// every further failure.
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+}
+
+type ScopeConfig struct {
+	Name        string
+	Description string
+}
+
+// SessionConfig configures the browser (SSO) session cookie.
+type SessionConfig struct {
+	CookieName string `mapstructure:"cookie_name"`
+	Lifetime   time.Duration
+	// Secure restricts the cookies to HTTPS. Only disable it for local HTTP.
+	Secure bool
 }
 
 type LogConfig struct {
@@ -72,8 +113,37 @@ func Load() (*Config, error) {
 }
 
 func (c *Config) validate() error {
-	if c.JWT.Secret == "" {
-		return fmt.Errorf("jwt.secret is required")
+	if c.JWT.Issuer == "" {
+		return fmt.Errorf("jwt.issuer is required")
+	}
+	if c.JWT.Expiry <= 0 || c.JWT.RefreshExpiry <= 0 {
+		return fmt.Errorf("jwt.expiry and jwt.refresh_expiry must be positive")
+	}
+	switch c.JWT.Algorithm {
+	case "RS256", "ES256", "EdDSA":
+	default:
+		return fmt.Errorf("jwt.algorithm must be RS256, ES256 or EdDSA")
+	}
+	if c.JWT.KeyRetention < c.JWT.Expiry {
+		return fmt.Errorf("jwt.key_retention must be at least jwt.expiry")
+	}
+	if c.OAuth.AuthCodeExpiry <= 0 || c.OAuth.AuthCodeExpiry > maxAuthCodeExpiry {
+		return fmt.Errorf("oauth.auth_code_expiry must be positive and at most 10m")
+	}
+	if c.OAuth.DeviceCodeExpiry <= 0 || c.OAuth.DevicePollInterval < time.Second {
+		return fmt.Errorf("oauth.device_code_expiry must be positive and oauth.device_poll_interval at least 1s")
+	}
+	if c.OAuth.ClientSecretGracePeriod < 0 {
+		return fmt.Errorf("oauth.client_secret_grace_period must not be negative")
+	}
+	if c.OAuth.BackchannelLogout.Timeout <= 0 || c.OAuth.BackchannelLogout.MaxAttempts < 1 || c.OAuth.BackchannelLogout.RetryInterval <= 0 {
+		return fmt.Errorf("oauth.backchannel_logout.timeout and retry_interval must be positive and max_attempts at least 1")
+	}
+	if c.Session.CookieName == "" || c.Session.Lifetime <= 0 {
+		return fmt.Errorf("session.cookie_name is required and session.lifetime must be positive")
+	}
+	if c.Database.Driver != "postgres" && c.Database.Driver != "sqlite" {
+		return fmt.Errorf("database.driver must be postgres or sqlite")
 	}
 	if c.Database.DSN == "" {
 		return fmt.Errorf("database.dsn is required")
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/ali/sso-server/internal/config"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Open opens a connection pool for the configured driver and verifies it with a ping.
+func Open(cfg config.DatabaseConfig) (*sql.DB, error) {
+	var (
+		db  *sql.DB
+		err error
+	)
+
+	switch cfg.Driver {
+	case DriverPostgres:
+		db, err = sql.Open("pgx", cfg.DSN)
+	case DriverSQLite:
+		db, err = sql.Open("sqlite", sqliteDSN(cfg.DSN))
+		if err == nil {
+			// SQLite allows a single writer; serialize access through one connection.
+			db.SetMaxOpenConns(1)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %q", cfg.Driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// sqliteDSN enables foreign keys and a busy timeout unless the DSN sets pragmas itself.
+func sqliteDSN(dsn string) string {
+	if strings.Contains(dsn, "_pragma=") {
+		return dsn
+	}
+
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+}
@@ -0,0 +1,2 @@
+ALTER TABLE sessions ADD COLUMN client_id UUID REFERENCES clients (id) ON DELETE CASCADE;
+ALTER TABLE sessions ADD COLUMN scope TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,10 @@
+ALTER TABLE sessions ADD COLUMN auth_time TIMESTAMPTZ;
+ALTER TABLE sessions ADD COLUMN amr TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE sessions ADD COLUMN acr TEXT NOT NULL DEFAULT '';
+UPDATE sessions SET auth_time = created_at;
+
+ALTER TABLE authorization_codes ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes ADD COLUMN auth_time TIMESTAMPTZ;
+ALTER TABLE authorization_codes ADD COLUMN amr TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE authorization_codes ADD COLUMN acr TEXT NOT NULL DEFAULT '';
+UPDATE authorization_codes SET auth_time = created_at;
@@ -0,0 +1,4 @@
+ALTER TABLE authorization_codes DROP COLUMN code_challenge_method;
+ALTER TABLE authorization_codes DROP COLUMN code_challenge;
+
+ALTER TABLE clients DROP COLUMN client_type;
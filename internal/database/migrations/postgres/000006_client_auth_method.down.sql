@@ -0,0 +1,2 @@
+ALTER TABLE clients DROP COLUMN jwks;
+ALTER TABLE clients DROP COLUMN token_endpoint_auth_method;
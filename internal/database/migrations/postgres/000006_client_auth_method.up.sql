@@ -0,0 +1,5 @@
+-- Existing clients authenticated with client_id/client_secret in the form body.
+ALTER TABLE clients ADD COLUMN token_endpoint_auth_method TEXT NOT NULL DEFAULT 'client_secret_post';
+ALTER TABLE clients ADD COLUMN jwks TEXT NOT NULL DEFAULT '';
+
+UPDATE clients SET token_endpoint_auth_method = 'none' WHERE client_type = 'public';
@@ -0,0 +1,7 @@
+ALTER TABLE clients ADD COLUMN secret_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN previous_secret_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN previous_secret_expires_at TIMESTAMPTZ;
+
+UPDATE clients SET secret_hash = encode(sha256(convert_to(secret, 'UTF8')), 'hex') WHERE secret <> '';
+
+ALTER TABLE clients DROP COLUMN secret;
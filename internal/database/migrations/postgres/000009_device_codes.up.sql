@@ -0,0 +1,15 @@
+CREATE TABLE device_codes (
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL UNIQUE,
+    client_id        UUID NOT NULL REFERENCES clients (id) ON DELETE CASCADE,
+    scope            TEXT NOT NULL DEFAULT '',
+    status           TEXT NOT NULL,
+    user_id          UUID REFERENCES users (id) ON DELETE CASCADE,
+    auth_time        TIMESTAMPTZ,
+    amr              TEXT NOT NULL DEFAULT '[]',
+    acr              TEXT NOT NULL DEFAULT '',
+    poll_interval    INTEGER NOT NULL,
+    last_polled_at   TIMESTAMPTZ,
+    expires_at       TIMESTAMPTZ NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,5 @@
+-- Hashed refresh tokens cannot be restored, so existing sessions are dropped.
+DROP TABLE refresh_tokens;
+
+DELETE FROM sessions;
+ALTER TABLE sessions ADD COLUMN refresh_token TEXT NOT NULL UNIQUE;
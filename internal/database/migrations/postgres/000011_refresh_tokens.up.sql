@@ -0,0 +1,15 @@
+-- Refresh tokens are stored hashed and rotated on use. All tokens of a
+-- session form one family; a rotated token is kept so its reuse is detected.
+CREATE TABLE refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id UUID NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    rotated_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
+
+INSERT INTO refresh_tokens (token_hash, session_id, created_at)
+SELECT encode(sha256(convert_to(refresh_token, 'UTF8')), 'hex'), id, created_at FROM sessions;
+
+ALTER TABLE sessions DROP COLUMN refresh_token;
@@ -0,0 +1 @@
+UPDATE clients SET allowed_scopes = '[]' WHERE allowed_scopes = '["openid","profile","email"]';
@@ -0,0 +1,3 @@
+-- Scopes are now enforced for every grant. Clients that never declared any
+-- keep signing users in by being allowed the built-in OIDC scopes.
+UPDATE clients SET allowed_scopes = '["openid","profile","email"]' WHERE allowed_scopes = '[]';
@@ -0,0 +1,5 @@
+-- Browser (SSO) sessions are identified by a cookie whose SHA-256 hash is
+-- stored here. API and OAuth sessions have none.
+ALTER TABLE sessions ADD COLUMN cookie_hash TEXT;
+
+CREATE UNIQUE INDEX sessions_cookie_hash_idx ON sessions (cookie_hash);
@@ -0,0 +1,10 @@
+-- Scopes each user has consented to per client. A request for scopes that
+-- are all covered here skips the consent screen.
+CREATE TABLE grants (
+    user_id    UUID NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id  UUID NOT NULL REFERENCES clients (id) ON DELETE CASCADE,
+    scopes     TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
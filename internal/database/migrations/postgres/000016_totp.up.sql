@@ -0,0 +1,4 @@
+-- A TOTP secret is stored when the user starts enrolling an authenticator app
+-- and only used for sign-in once a code has confirmed it.
+ALTER TABLE users ADD COLUMN totp_secret TEXT;
+ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
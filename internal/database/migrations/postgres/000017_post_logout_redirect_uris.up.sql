@@ -0,0 +1,2 @@
+-- URIs a client may ask to be sent back to after RP-initiated logout.
+ALTER TABLE clients ADD COLUMN post_logout_redirect_uris TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN totp_locked_until;
+ALTER TABLE users DROP COLUMN totp_failed_attempts;
+ALTER TABLE users DROP COLUMN totp_last_step;
@@ -0,0 +1,5 @@
+-- The time step of the last accepted TOTP code, so that no code is accepted
+-- twice, and the attempts since then, to lock out guessing.
+ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN totp_locked_until TIMESTAMPTZ;
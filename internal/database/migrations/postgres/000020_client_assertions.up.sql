@@ -0,0 +1,11 @@
+-- jti values of private_key_jwt client assertions that have been used, so
+-- each assertion is accepted only once. Rows can be pruned once expires_at has
+-- passed since the assertion is rejected as expired anyway.
+CREATE TABLE client_assertions (
+    client_id  UUID NOT NULL REFERENCES clients (id) ON DELETE CASCADE,
+    jti        TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (client_id, jti)
+);
+
+CREATE INDEX client_assertions_expires_at_idx ON client_assertions (expires_at);
@@ -0,0 +1,6 @@
+-- New keys are published before they sign anything, so that other instances
+-- and relying parties have fetched them by the time they do. Existing keys
+-- became active when they were created.
+ALTER TABLE signing_keys ADD COLUMN activates_at TIMESTAMPTZ;
+UPDATE signing_keys SET activates_at = created_at;
+ALTER TABLE signing_keys ALTER COLUMN activates_at SET NOT NULL;
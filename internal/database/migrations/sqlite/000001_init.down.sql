@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS authorization_codes;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS clients;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,18 @@
+-- SQLite cannot drop a column that takes part in a foreign key, so rebuild the table.
+CREATE TABLE sessions_old (
+    id            TEXT PRIMARY KEY,
+    user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token TEXT NOT NULL UNIQUE,
+    user_agent    TEXT NOT NULL DEFAULT '',
+    ip_address    TEXT NOT NULL DEFAULT '',
+    expires_at    TIMESTAMP NOT NULL,
+    created_at    TIMESTAMP NOT NULL
+);
+
+INSERT INTO sessions_old (id, user_id, refresh_token, user_agent, ip_address, expires_at, created_at)
+SELECT id, user_id, refresh_token, user_agent, ip_address, expires_at, created_at FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_old RENAME TO sessions;
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
@@ -0,0 +1,8 @@
+ALTER TABLE authorization_codes DROP COLUMN acr;
+ALTER TABLE authorization_codes DROP COLUMN amr;
+ALTER TABLE authorization_codes DROP COLUMN auth_time;
+ALTER TABLE authorization_codes DROP COLUMN nonce;
+
+ALTER TABLE sessions DROP COLUMN acr;
+ALTER TABLE sessions DROP COLUMN amr;
+ALTER TABLE sessions DROP COLUMN auth_time;
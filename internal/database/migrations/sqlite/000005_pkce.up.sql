@@ -0,0 +1,4 @@
+ALTER TABLE clients ADD COLUMN client_type TEXT NOT NULL DEFAULT 'confidential';
+
+ALTER TABLE authorization_codes ADD COLUMN code_challenge TEXT NOT NULL DEFAULT '';
+ALTER TABLE authorization_codes ADD COLUMN code_challenge_method TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+-- Hashed secrets cannot be reversed; clients must be issued new secrets.
+ALTER TABLE clients ADD COLUMN secret TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE clients DROP COLUMN previous_secret_expires_at;
+ALTER TABLE clients DROP COLUMN previous_secret_hash;
+ALTER TABLE clients DROP COLUMN secret_hash;
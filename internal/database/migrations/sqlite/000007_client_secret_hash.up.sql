@@ -0,0 +1,7 @@
+-- SQLite has no SHA-256 function, so existing plaintext secrets cannot be
+-- carried over; affected clients must rotate their secret.
+ALTER TABLE clients ADD COLUMN secret_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN previous_secret_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE clients ADD COLUMN previous_secret_expires_at TIMESTAMP;
+
+ALTER TABLE clients DROP COLUMN secret;
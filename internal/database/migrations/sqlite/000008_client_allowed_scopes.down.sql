@@ -0,0 +1 @@
+ALTER TABLE clients DROP COLUMN allowed_scopes;
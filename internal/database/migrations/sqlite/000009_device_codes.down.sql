@@ -0,0 +1 @@
+DROP TABLE device_codes;
@@ -0,0 +1,15 @@
+CREATE TABLE device_codes (
+    device_code_hash TEXT PRIMARY KEY,
+    user_code        TEXT NOT NULL UNIQUE,
+    client_id        TEXT NOT NULL REFERENCES clients (id) ON DELETE CASCADE,
+    scope            TEXT NOT NULL DEFAULT '',
+    status           TEXT NOT NULL,
+    user_id          TEXT REFERENCES users (id) ON DELETE CASCADE,
+    auth_time        TIMESTAMP,
+    amr              TEXT NOT NULL DEFAULT '[]',
+    acr              TEXT NOT NULL DEFAULT '',
+    poll_interval    INTEGER NOT NULL,
+    last_polled_at   TIMESTAMP,
+    expires_at       TIMESTAMP NOT NULL,
+    created_at       TIMESTAMP NOT NULL
+);
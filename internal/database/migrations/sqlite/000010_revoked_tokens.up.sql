@@ -0,0 +1,8 @@
+-- Access tokens revoked before they expire, by jti. Rows can be pruned once
+-- expires_at has passed since the token is rejected as expired anyway.
+CREATE TABLE revoked_tokens (
+    jti        TEXT PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
@@ -0,0 +1,20 @@
+-- Hashed refresh tokens cannot be restored, so existing sessions are dropped.
+DROP TABLE refresh_tokens;
+
+DROP TABLE sessions;
+CREATE TABLE sessions (
+    id            TEXT PRIMARY KEY,
+    user_id       TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    refresh_token TEXT NOT NULL UNIQUE,
+    user_agent    TEXT NOT NULL DEFAULT '',
+    ip_address    TEXT NOT NULL DEFAULT '',
+    expires_at    TIMESTAMP NOT NULL,
+    created_at    TIMESTAMP NOT NULL,
+    client_id     TEXT REFERENCES clients (id) ON DELETE CASCADE,
+    scope         TEXT NOT NULL DEFAULT '',
+    auth_time     TIMESTAMP,
+    amr           TEXT NOT NULL DEFAULT '[]',
+    acr           TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
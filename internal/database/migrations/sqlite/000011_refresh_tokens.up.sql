@@ -0,0 +1,35 @@
+-- SQLite cannot drop a UNIQUE column, so rebuild the table. It also has no
+-- SHA-256 function: existing refresh tokens are dropped and their users must
+-- sign in again.
+CREATE TABLE sessions_new (
+    id         TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    client_id  TEXT REFERENCES clients (id) ON DELETE CASCADE,
+    scope      TEXT NOT NULL DEFAULT '',
+    auth_time  TIMESTAMP,
+    amr        TEXT NOT NULL DEFAULT '[]',
+    acr        TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO sessions_new (id, user_id, client_id, scope, auth_time, amr, acr, user_agent, ip_address, expires_at, created_at)
+SELECT id, user_id, client_id, scope, auth_time, amr, acr, user_agent, ip_address, expires_at, created_at FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);
+
+-- Refresh tokens are stored hashed and rotated on use. All tokens of a
+-- session form one family; a rotated token is kept so its reuse is detected.
+CREATE TABLE refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    rotated_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX refresh_tokens_session_id_idx ON refresh_tokens (session_id);
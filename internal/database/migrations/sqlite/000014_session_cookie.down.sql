@@ -0,0 +1,2 @@
+DROP INDEX sessions_cookie_hash_idx;
+ALTER TABLE sessions DROP COLUMN cookie_hash;
@@ -0,0 +1,8 @@
+DROP TABLE logout_deliveries;
+
+DROP INDEX sessions_parent_id_idx;
+ALTER TABLE device_codes DROP COLUMN session_id;
+ALTER TABLE authorization_codes DROP COLUMN session_id;
+ALTER TABLE sessions DROP COLUMN parent_id;
+
+ALTER TABLE clients DROP COLUMN backchannel_logout_uri;
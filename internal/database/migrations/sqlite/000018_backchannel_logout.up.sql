@@ -0,0 +1,31 @@
+-- Clients may register an endpoint to be told when a user's session with
+-- them ends (OpenID Connect Back-Channel Logout 1.0).
+ALTER TABLE clients ADD COLUMN backchannel_logout_uri TEXT NOT NULL DEFAULT '';
+
+-- OAuth sessions remember the browser session they were issued from, so
+-- signing out of it ends them as well. Codes carry it until the exchange.
+-- There is no foreign key: a parent only goes away together with its
+-- children, and SQLite could not drop the column again.
+ALTER TABLE sessions ADD COLUMN parent_id TEXT;
+ALTER TABLE authorization_codes ADD COLUMN session_id TEXT;
+ALTER TABLE device_codes ADD COLUMN session_id TEXT;
+
+CREATE INDEX sessions_parent_id_idx ON sessions (parent_id);
+
+-- Logout tokens waiting to be delivered, and the outcome of past deliveries.
+CREATE TABLE logout_deliveries (
+    id              TEXT PRIMARY KEY,
+    client_id       TEXT NOT NULL REFERENCES clients (id) ON DELETE CASCADE,
+    user_id         TEXT NOT NULL,
+    session_id      TEXT NOT NULL,
+    uri             TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    last_error      TEXT NOT NULL DEFAULT '',
+    next_attempt_at TIMESTAMP NOT NULL,
+    created_at      TIMESTAMP NOT NULL,
+    updated_at      TIMESTAMP NOT NULL
+);
+
+CREATE INDEX logout_deliveries_client_id_idx ON logout_deliveries (client_id);
+CREATE INDEX logout_deliveries_status_idx ON logout_deliveries (status, next_attempt_at);
@@ -0,0 +1,5 @@
+-- New keys are published before they sign anything, so that other instances
+-- and relying parties have fetched them by the time they do. Existing keys
+-- became active when they were created.
+ALTER TABLE signing_keys ADD COLUMN activates_at TIMESTAMP;
+UPDATE signing_keys SET activates_at = created_at;
@@ -1,19 +1,40 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/middleware"
 	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/ali/sso-server/internal/token"
 	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type AuthHandler struct {
-	// TODO: add auth service
+	config   *config.Config
+	repo     *repository.Repository
+	tokens   *token.Service
+	sessions *middleware.Sessions
+	logouts  *backchannel.Notifier
 }
 
-func NewAuthHandler() *AuthHandler {
-	return &AuthHandler{}
+func NewAuthHandler(cfg *config.Config, repo *repository.Repository, tokens *token.Service, sessions *middleware.Sessions, logouts *backchannel.Notifier) *AuthHandler {
+	return &AuthHandler{
+		config:   cfg,
+		repo:     repo,
+		tokens:   tokens,
+		sessions: sessions,
+		logouts:  logouts,
+	}
 }
 
 // Register godoc
@@ -33,16 +54,44 @@ func (h *AuthHandler) Register(c echo.Context) error {
 		return badRequest(c, "invalid request body")
 	}
 
-	// TODO: validate request
-	// TODO: check if user exists
-	// TODO: hash password
-	// TODO: create user
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if req.Email == "" || req.Name == "" || len(req.Password) < 8 {
+		return badRequest(c, "email, name and a password of at least 8 characters are required")
+	}
 
-	logger.Info("user registered", "email", req.Email)
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("failed to hash password", "error", err)
+		return internalError(c, "failed to register user")
+	}
+
+	now := time.Now().UTC()
+	user := &model.User{
+		ID:           uuid.New(),
+		Email:        req.Email,
+		PasswordHash: string(hash),
+		Name:         req.Name,
+		Roles:        []string{},
+		IsActive:     true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	if err := h.repo.Users.Create(c.Request().Context(), user); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return conflict(c, "email already registered")
+		}
+		logger.Error("failed to create user", "error", err)
+		return internalError(c, "failed to register user")
+	}
+
+	logger.Info("user registered", "user_id", user.ID)
 
 	return c.JSON(http.StatusCreated, model.UserResponse{
-		Email: req.Email,
-		Name:  req.Name,
+		ID:    user.ID,
+		Email: user.Email,
+		Name:  user.Name,
+		Roles: user.Roles,
 	})
 }
 
@@ -57,25 +106,63 @@ func (h *AuthHandler) Register(c echo.Context) error {
 // @Failure 401 {object} ErrorResponse
 // @Router /api/v1/auth/login [post]
 func (h *AuthHandler) Login(c echo.Context) error {
+	noStore(c)
+
 	var req model.LoginRequest
 	if err := c.Bind(&req); err != nil {
 		logger.Error("failed to bind login request", "error", err)
 		return badRequest(c, "invalid request body")
 	}
 
-	// TODO: validate request
-	// TODO: find user by email
-	// TODO: verify password
-	// TODO: generate tokens
-	// TODO: create session
+	ctx := c.Request().Context()
+
+	user, err := h.checkCredentials(c, req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, errInvalidCredentials) || errors.Is(err, errAccountDisabled) {
+			return unauthorized(c, err.Error())
+		}
+		return internalError(c, "failed to login")
+	}
+
+	now := time.Now().UTC()
+	session := &model.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		AuthTime:  now,
+		AMR:       []string{"pwd"},
+		ACR:       model.ACRPassword,
+		UserAgent: c.Request().UserAgent(),
+		IPAddress: c.RealIP(),
+		ExpiresAt: now.Add(h.tokens.RefreshTokenExpiry()),
+		CreatedAt: now,
+	}
+	if err := h.repo.Sessions.Create(ctx, session); err != nil {
+		logger.Error("failed to create session", "error", err)
+		return internalError(c, "failed to login")
+	}
+
+	refreshToken, err := issueRefreshToken(c, h.repo, session.ID)
+	if err != nil {
+		return internalError(c, "failed to login")
+	}
+
+	accessToken, _, err := h.tokens.IssueAccessToken(token.AccessTokenParams{
+		Subject:   user.ID.String(),
+		Scope:     scope.Account,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		logger.Error("failed to issue access token", "error", err)
+		return internalError(c, "failed to login")
+	}
 
-	logger.Info("user logged in", "email", req.Email)
+	logger.Info("user logged in", "user_id", user.ID, "session_id", session.ID)
 
 	return c.JSON(http.StatusOK, model.TokenResponse{
-		AccessToken:  "access_token_placeholder",
-		RefreshToken: "refresh_token_placeholder",
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    3600,
+		ExpiresIn:    int(h.tokens.AccessTokenExpiry().Seconds()),
 	})
 }
 
@@ -90,24 +177,53 @@ func (h *AuthHandler) Login(c echo.Context) error {
 // @Failure 401 {object} ErrorResponse
 // @Router /api/v1/auth/refresh [post]
 func (h *AuthHandler) Refresh(c echo.Context) error {
+	noStore(c)
+
 	var req model.RefreshTokenRequest
 	if err := c.Bind(&req); err != nil {
 		logger.Error("failed to bind refresh request", "error", err)
 		return badRequest(c, "invalid request body")
 	}
 
-	// TODO: validate refresh token
-	// TODO: find session
-	// TODO: generate new tokens
-	// TODO: rotate refresh token
+	rt, session, err := findRefreshToken(c, h.repo, h.logouts, req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errRefreshTokenReused) {
+			return unauthorized(c, "invalid refresh token")
+		}
+		return internalError(c, "failed to refresh token")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return unauthorized(c, "refresh token expired")
+	}
+	if session.ClientID.Valid {
+		return unauthorized(c, "refresh token was issued to an OAuth client")
+	}
 
-	logger.Info("token refreshed")
+	refreshToken, err := rotateRefreshToken(c, h.repo, h.logouts, rt, session)
+	if err != nil {
+		if errors.Is(err, errRefreshTokenReused) {
+			return unauthorized(c, "invalid refresh token")
+		}
+		return internalError(c, "failed to refresh token")
+	}
+
+	accessToken, _, err := h.tokens.IssueAccessToken(token.AccessTokenParams{
+		Subject:   session.UserID.String(),
+		Scope:     scope.Account,
+		SessionID: session.ID,
+	})
+	if err != nil {
+		logger.Error("failed to issue access token", "error", err)
+		return internalError(c, "failed to refresh token")
+	}
+
+	logger.Info("token refreshed", "session_id", session.ID)
 
 	return c.JSON(http.StatusOK, model.TokenResponse{
-		AccessToken:  "new_access_token_placeholder",
-		RefreshToken: "new_refresh_token_placeholder",
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    3600,
+		ExpiresIn:    int(h.tokens.AccessTokenExpiry().Seconds()),
 	})
 }
 
@@ -119,10 +235,30 @@ func (h *AuthHandler) Refresh(c echo.Context) error {
 // @Failure 401 {object} ErrorResponse
 // @Router /api/v1/auth/logout [post]
 func (h *AuthHandler) Logout(c echo.Context) error {
-	// TODO: get user from context
-	// TODO: invalidate session
+	p, ok := middleware.GetPrincipal(c)
+	if !ok || p.IsClient() {
+		return unauthorized(c, "authentication required")
+	}
+
+	ctx := c.Request().Context()
+
+	// The caller is the session's own client, so it is not notified.
+	if p.SessionID != uuid.Nil {
+		if err := h.repo.Sessions.Delete(ctx, p.SessionID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to delete session", "error", err)
+			return internalError(c, "failed to logout")
+		}
+	}
+
+	// Denylist the presented token too, in case it carries no session.
+	if p.Claims.ExpiresAt != nil {
+		if err := h.repo.RevokedTokens.Revoke(ctx, p.Claims.ID, p.Claims.ExpiresAt.Time); err != nil {
+			logger.Error("failed to revoke access token", "error", err)
+			return internalError(c, "failed to logout")
+		}
+	}
 
-	logger.Info("user logged out")
+	logger.Info("user logged out", "user_id", p.UserID, "session_id", p.SessionID)
 
 	return c.NoContent(http.StatusNoContent)
 }
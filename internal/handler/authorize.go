@@ -0,0 +1,455 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// Values of the OIDC prompt parameter.
+const (
+	promptNone          = "none"
+	promptLogin         = "login"
+	promptConsent       = "consent"
+	promptSelectAccount = "select_account"
+)
+
+var supportedPromptValues = []string{promptNone, promptLogin, promptConsent, promptSelectAccount}
+
+// authorizeRequest is a validated authorization request.
+type authorizeRequest struct {
+	client              *model.Client
+	redirectURI         string
+	state               string
+	scopes              []string
+	nonce               string
+	codeChallenge       string
+	codeChallengeMethod string
+	prompt              []string
+	// maxAge is the longest time since the user signed in that the client
+	// accepts, or -1 if it did not ask.
+	maxAge    time.Duration
+	loginHint string
+	acrValues []string
+	// params are the request's original parameters, replayed after signing in
+	// and by the consent form.
+	params url.Values
+}
+
+func (r *authorizeRequest) hasPrompt(value string) bool {
+	return slices.Contains(r.prompt, value)
+}
+
+type consentPage struct {
+	Title      string
+	Error      string
+	CSRF       string
+	ClientName string
+	Scopes     []scope.Scope
+	Params     url.Values
+}
+
+// Authorize godoc
+// @Summary OAuth2 authorization endpoint
+// @Description Issues an authorization code to a signed-in user. Users are sent
+// @Description to /login first, and to the consent screen unless they already
+// @Description granted every requested scope to the client. With prompt=none
+// @Description the user is never shown a page; the request fails with
+// @Description login_required or consent_required instead.
+// @Tags oauth
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Redirect URI"
+// @Param response_type query string true "Response type (code)"
+// @Param scope query string false "Requested scope"
+// @Param state query string true "State parameter"
+// @Param nonce query string false "OpenID Connect nonce"
+// @Param code_challenge query string false "PKCE code challenge (required for public clients)"
+// @Param code_challenge_method query string false "PKCE method (S256 or plain)"
+// @Param prompt query string false "Space-separated: none, login, consent or select_account"
+// @Param max_age query int false "Maximum seconds since the user last signed in"
+// @Param login_hint query string false "Email to prefill on the login page"
+// @Param acr_values query string false "Requested authentication context classes (pwd or mfa)"
+// @Success 200 "Consent screen"
+// @Success 302 "Redirect to redirect_uri with code and state, or with error, error_description and state"
+// @Failure 400 {string} string "HTML error page when client_id or redirect_uri is invalid"
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) Authorize(c echo.Context) error {
+	req, err := h.parseAuthorizeRequest(c, c.QueryParams())
+	if req == nil {
+		return err
+	}
+
+	session, err := h.authenticateRequest(c, req)
+	if session == nil {
+		return err
+	}
+	userID := session.UserID
+
+	granted, err := h.grantedScopes(c, userID, req.client.ID)
+	if err != nil {
+		return authorizeError(c, req.redirectURI, req.state, "server_error", "failed to authorize")
+	}
+	if granted == nil || req.hasPrompt(promptConsent) || !coversScopes(granted, req.scopes) {
+		if req.hasPrompt(promptNone) {
+			return authorizeError(c, req.redirectURI, req.state, "consent_required", "the user has not approved the requested scopes")
+		}
+		return render(c, http.StatusOK, "consent.html", &consentPage{
+			Title:      "Authorize " + req.client.Name,
+			CSRF:       middleware.CSRFToken(c),
+			ClientName: req.client.Name,
+			Scopes:     h.scopes.Describe(req.scopes),
+			Params:     req.params,
+		})
+	}
+
+	return h.issueAuthorizationCode(c, req, userID)
+}
+
+// AuthorizeDecision godoc
+// @Summary Submit the consent screen
+// @Tags oauth
+// @Accept application/x-www-form-urlencoded
+// @Param action formData string true "approve or deny"
+// @Success 302 "Redirect to redirect_uri with code and state, or with error=access_denied"
+// @Failure 400 {string} string "HTML error page when client_id or redirect_uri is invalid"
+// @Router /oauth/authorize [post]
+func (h *OAuthHandler) AuthorizeDecision(c echo.Context) error {
+	form, err := c.FormParams()
+	if err != nil {
+		return renderError(c, http.StatusBadRequest, "The request could not be read.")
+	}
+
+	params := url.Values{}
+	for name, values := range form {
+		if name != "csrf" && name != "action" {
+			params[name] = values
+		}
+	}
+
+	req, err := h.parseAuthorizeRequest(c, params)
+	if req == nil {
+		return err
+	}
+
+	switch c.FormValue("action") {
+	case "approve":
+		// The form can be posted without the consent screen having been
+		// shown, and the session may have aged past max_age or ended since,
+		// so the user is held to the same requirements as on GET.
+		session, err := h.authenticateRequest(c, req)
+		if session == nil {
+			return err
+		}
+		userID := session.UserID
+
+		if err := h.grantScopes(c, userID, req.client.ID, req.scopes); err != nil {
+			return authorizeError(c, req.redirectURI, req.state, "server_error", "failed to authorize")
+		}
+		logger.Info("oauth consent granted", "client_id", req.client.ID, "user_id", userID, "scope", strings.Join(req.scopes, " "))
+		return h.issueAuthorizationCode(c, req, userID)
+	case "deny":
+		userID, ok := middleware.UserID(c)
+		if !ok {
+			// The session ended while the consent screen was open.
+			return redirectToLogin(c, authorizePath(params), nil)
+		}
+		logger.Info("oauth consent denied", "client_id", req.client.ID, "user_id", userID)
+		return authorizeError(c, req.redirectURI, req.state, "access_denied", "the user denied the request")
+	default:
+		return renderError(c, http.StatusBadRequest, "Unknown action.")
+	}
+}
+
+// parseAuthorizeRequest validates the parameters of an authorization request.
+// When it returns a nil request the error page or error redirect has already
+// been written and err should be returned as is.
+func (h *OAuthHandler) parseAuthorizeRequest(c echo.Context, params url.Values) (*authorizeRequest, error) {
+	clientID := params.Get("client_id")
+	redirectURI := params.Get("redirect_uri")
+	responseType := params.Get("response_type")
+	state := params.Get("state")
+
+	// Until the client and redirect URI are verified, errors are shown to the
+	// user rather than sent to a URI that may belong to an attacker.
+	if clientID == "" || redirectURI == "" {
+		return nil, renderError(c, http.StatusBadRequest, "The request is missing client_id or redirect_uri.")
+	}
+
+	client, err := h.findClient(c, clientID)
+	if err != nil {
+		return nil, renderError(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+	}
+	if client == nil {
+		return nil, renderError(c, http.StatusBadRequest, "The application is unknown or disabled.")
+	}
+
+	if !matchRedirectURI(client.RedirectURIs, redirectURI) {
+		logger.Warn("oauth authorize rejected unregistered redirect_uri", "client_id", client.ID, "redirect_uri", redirectURI)
+		return nil, renderError(c, http.StatusBadRequest, "The redirect URI is not registered for this application.")
+	}
+
+	// From here on errors go back to the client (RFC 6749, section 4.1.2.1).
+	fail := func(code, description string) (*authorizeRequest, error) {
+		return nil, authorizeError(c, redirectURI, state, code, description)
+	}
+
+	if responseType == "" || state == "" {
+		return fail("invalid_request", "response_type and state are required")
+	}
+	if !slices.Contains(supportedResponseTypes, responseType) {
+		return fail("unsupported_response_type", "response_type must be code")
+	}
+
+	req := &authorizeRequest{
+		client:              client,
+		redirectURI:         redirectURI,
+		state:               state,
+		nonce:               params.Get("nonce"),
+		codeChallenge:       params.Get("code_challenge"),
+		codeChallengeMethod: params.Get("code_challenge_method"),
+		prompt:              strings.Fields(params.Get("prompt")),
+		maxAge:              -1,
+		loginHint:           params.Get("login_hint"),
+		acrValues:           strings.Fields(params.Get("acr_values")),
+		params:              params,
+	}
+
+	if req.hasPrompt(promptNone) && len(req.prompt) > 1 {
+		return fail("invalid_request", "prompt=none cannot be combined with other values")
+	}
+	if raw := params.Get("max_age"); raw != "" {
+		seconds, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || seconds < 0 {
+			return fail("invalid_request", "max_age must be a non-negative integer")
+		}
+		req.maxAge = time.Duration(seconds) * time.Second
+	}
+
+	if req.codeChallenge != "" {
+		if req.codeChallengeMethod == "" {
+			req.codeChallengeMethod = pkceMethodPlain
+		}
+		if !slices.Contains(codeChallengeMethods(h.config.OAuth), req.codeChallengeMethod) {
+			return fail("invalid_request", "unsupported code_challenge_method")
+		}
+		if !pkceValue.MatchString(req.codeChallenge) {
+			return fail("invalid_request", "invalid code_challenge")
+		}
+	} else if client.IsPublic() {
+		return fail("invalid_request", "public clients must use PKCE")
+	}
+
+	req.scopes = strings.Fields(params.Get("scope"))
+	if err := h.scopes.Validate(req.scopes, client.AllowedScopes); err != nil {
+		return fail("invalid_scope", err.Error())
+	}
+
+	return req, nil
+}
+
+// authenticateRequest returns the browser session the authorization request
+// can be approved with. The user is sent to sign in if there is no session,
+// the client asked for a fresh sign-in (prompt=login or select_account), or
+// the session is older than max_age; and to enter a second factor if the
+// client asked for acr=mfa. Every code is issued only after these checks.
+// When it returns a nil session the response has been written and err should
+// be returned as is.
+func (h *OAuthHandler) authenticateRequest(c echo.Context, req *authorizeRequest) (*model.Session, error) {
+	session, ok := middleware.BrowserSession(c)
+	switch {
+	case !ok:
+		return nil, h.requireLogin(c, req, "")
+	case req.hasPrompt(promptLogin):
+		return nil, h.requireLogin(c, req, promptLogin)
+	case req.hasPrompt(promptSelectAccount):
+		return nil, h.requireLogin(c, req, promptSelectAccount)
+	case req.maxAge >= 0 && time.Since(session.AuthTime).Truncate(time.Second) > req.maxAge:
+		return nil, h.requireLogin(c, req, promptLogin)
+	}
+
+	stepUp, err := h.needsStepUp(c, req, session)
+	if err != nil {
+		return nil, authorizeError(c, req.redirectURI, req.state, "server_error", "failed to authorize")
+	}
+	if stepUp {
+		if req.hasPrompt(promptNone) {
+			return nil, authorizeError(c, req.redirectURI, req.state, "login_required", "a second factor is required")
+		}
+		return nil, c.Redirect(http.StatusFound, mfaPath+"?return_to="+url.QueryEscape(authorizePath(req.params)))
+	}
+
+	return session, nil
+}
+
+// requireLogin sends the user to the login page, or fails the request if the
+// client asked for no interaction. prompt is passed to the page to make it ask
+// a signed-in user to sign in again or pick an account; it is dropped from
+// the request that is replayed afterwards so the user is not asked twice.
+func (h *OAuthHandler) requireLogin(c echo.Context, req *authorizeRequest, prompt string) error {
+	if req.hasPrompt(promptNone) {
+		return authorizeError(c, req.redirectURI, req.state, "login_required", "the user must sign in")
+	}
+
+	replay := url.Values{}
+	for name, values := range req.params {
+		replay[name] = values
+	}
+	remaining := slices.DeleteFunc(slices.Clone(req.prompt), func(p string) bool {
+		return p == promptLogin || p == promptSelectAccount
+	})
+	if len(remaining) > 0 {
+		replay.Set("prompt", strings.Join(remaining, " "))
+	} else {
+		replay.Del("prompt")
+	}
+
+	params := url.Values{}
+	if req.loginHint != "" {
+		params.Set("login_hint", req.loginHint)
+	}
+	if prompt != "" {
+		params.Set("prompt", prompt)
+	}
+	return redirectToLogin(c, authorizePath(replay), params)
+}
+
+// needsStepUp reports whether the client asked for a stronger authentication
+// than the session has and the user can provide it. acr_values are voluntary
+// (OIDC Core, section 3.1.2.1): users without a second factor are let through
+// and the ID token's acr claim tells the client what was achieved. A non-nil
+// error has been logged.
+func (h *OAuthHandler) needsStepUp(c echo.Context, req *authorizeRequest, session *model.Session) (bool, error) {
+	if !slices.Contains(req.acrValues, model.ACRMFA) || session.ACR == model.ACRMFA {
+		return false, nil
+	}
+
+	user, err := h.repo.Users.GetByID(c.Request().Context(), session.UserID)
+	if err != nil {
+		logger.Error("failed to fetch user", "error", err)
+		return false, err
+	}
+	return user.TOTPEnabled, nil
+}
+
+// authorizePath returns the local URL of an authorization request, used to
+// resume it after signing in.
+func authorizePath(params url.Values) string {
+	return "/oauth/authorize?" + params.Encode()
+}
+
+// issueAuthorizationCode stores a code for the approved request and redirects
+// back to the client with it.
+func (h *OAuthHandler) issueAuthorizationCode(c echo.Context, req *authorizeRequest, userID uuid.UUID) error {
+	authTime, amr, acr, err := h.authContext(c)
+	if err != nil {
+		return authorizeError(c, req.redirectURI, req.state, "server_error", "failed to authorize")
+	}
+
+	scope := strings.Join(req.scopes, " ")
+
+	logger.Info("oauth authorize request",
+		"client_id", req.client.ID,
+		"redirect_uri", req.redirectURI,
+		"scope", scope,
+	)
+
+	code, err := randomToken(32)
+	if err != nil {
+		logger.Error("failed to generate authorization code", "error", err)
+		return authorizeError(c, req.redirectURI, req.state, "server_error", "failed to authorize")
+	}
+
+	now := time.Now().UTC()
+	authCode := &model.AuthorizationCode{
+		Code:        code,
+		ClientID:    req.client.ID,
+		UserID:      userID,
+		SessionID:   browserSessionID(c),
+		RedirectURI: req.redirectURI,
+		Scope:       scope,
+		Nonce:       req.nonce,
+		AuthTime:    authTime,
+		AMR:         amr,
+		ACR:         acr,
+
+		CodeChallenge:       req.codeChallenge,
+		CodeChallengeMethod: req.codeChallengeMethod,
+		ExpiresAt:           now.Add(h.config.OAuth.AuthCodeExpiry),
+		CreatedAt:           now,
+	}
+	if err := h.repo.AuthCodes.Create(c.Request().Context(), authCode); err != nil {
+		logger.Error("failed to store authorization code", "error", err)
+		return authorizeError(c, req.redirectURI, req.state, "server_error", "failed to authorize")
+	}
+
+	return redirectWithParams(c, req.redirectURI, url.Values{
+		"code":  {code},
+		"state": {req.state},
+	})
+}
+
+// grantedScopes returns the scopes the user has granted the client, or nil if
+// the user never approved it. A non-nil error has been logged.
+func (h *OAuthHandler) grantedScopes(c echo.Context, userID, clientID uuid.UUID) ([]string, error) {
+	grant, err := h.repo.Grants.Get(c.Request().Context(), userID, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to fetch grant", "error", err)
+		return nil, err
+	}
+	if grant.Scopes == nil {
+		return []string{}, nil
+	}
+	return grant.Scopes, nil
+}
+
+// grantScopes remembers that the user approved scopes for the client, on top
+// of whatever was granted before. A non-nil error has been logged.
+func (h *OAuthHandler) grantScopes(c echo.Context, userID, clientID uuid.UUID, scopes []string) error {
+	granted, err := h.grantedScopes(c, userID, clientID)
+	if err != nil {
+		return err
+	}
+	for _, s := range scopes {
+		if !slices.Contains(granted, s) {
+			granted = append(granted, s)
+		}
+	}
+
+	now := time.Now().UTC()
+	if err := h.repo.Grants.Save(c.Request().Context(), &model.Grant{
+		UserID:    userID,
+		ClientID:  clientID,
+		Scopes:    granted,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}); err != nil {
+		logger.Error("failed to save grant", "error", err)
+		return err
+	}
+	return nil
+}
+
+// coversScopes reports whether every requested scope has been granted.
+func coversScopes(granted, requested []string) bool {
+	for _, s := range requested {
+		if !slices.Contains(granted, s) {
+			return false
+		}
+	}
+	return true
+}
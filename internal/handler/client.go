@@ -1,20 +1,39 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/keys"
 	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
 	"github.com/ali/sso-server/pkg/logger"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// clientSecretBytes is the entropy of generated client secrets.
+	clientSecretBytes = 32
+	// logoutDeliveryLimit caps the back-channel logout log returned per client.
+	logoutDeliveryLimit = 100
+)
+
 type ClientHandler struct {
-	// TODO: add client service
+	config *config.Config
+	repo   *repository.Repository
+	scopes *scope.Registry
 }
 
-func NewClientHandler() *ClientHandler {
-	return &ClientHandler{}
+func NewClientHandler(cfg *config.Config, repo *repository.Repository, scopes *scope.Registry) *ClientHandler {
+	return &ClientHandler{
+		config: cfg,
+		repo:   repo,
+		scopes: scopes,
+	}
 }
 
 // Create godoc
@@ -35,20 +54,175 @@ func (h *ClientHandler) Create(c echo.Context) error {
 		return badRequest(c, "invalid request body")
 	}
 
-	// TODO: validate request
-	// TODO: generate client secret
-	// TODO: create client in database
+	if req.Name == "" || len(req.RedirectURIs) == 0 {
+		return badRequest(c, "name and at least one redirect_uri are required")
+	}
+	for _, uri := range req.RedirectURIs {
+		if !validRedirectURI(uri) {
+			return badRequest(c, "redirect_uris must be absolute URIs without a fragment: "+uri)
+		}
+	}
+	for _, uri := range req.PostLogoutRedirectURIs {
+		if !validRedirectURI(uri) {
+			return badRequest(c, "post_logout_redirect_uris must be absolute URIs without a fragment: "+uri)
+		}
+	}
+	if req.BackchannelLogoutURI != "" && !validBackchannelLogoutURI(req.BackchannelLogoutURI) {
+		return badRequest(c, "backchannel_logout_uri must be an absolute http or https URI without a fragment")
+	}
+
+	switch req.Type {
+	case "":
+		req.Type = model.ClientTypeConfidential
+	case model.ClientTypeConfidential, model.ClientTypePublic:
+	default:
+		return badRequest(c, "client_type must be confidential or public")
+	}
+
+	if req.AuthMethod == "" {
+		req.AuthMethod = model.AuthMethodClientSecretBasic
+		if req.Type == model.ClientTypePublic {
+			req.AuthMethod = model.AuthMethodNone
+		}
+	}
+	switch req.AuthMethod {
+	case model.AuthMethodClientSecretBasic, model.AuthMethodClientSecretPost, model.AuthMethodPrivateKeyJWT:
+		if req.Type == model.ClientTypePublic {
+			return badRequest(c, "public clients must use token_endpoint_auth_method none")
+		}
+	case model.AuthMethodNone:
+		if req.Type != model.ClientTypePublic {
+			return badRequest(c, "confidential clients must authenticate at the token endpoint")
+		}
+	default:
+		return badRequest(c, "unsupported token_endpoint_auth_method")
+	}
+
+	// Clients registered without allowed scopes may only sign users in.
+	if len(req.AllowedScopes) == 0 {
+		req.AllowedScopes = h.scopes.OIDCNames()
+	}
+	for _, name := range req.AllowedScopes {
+		if _, ok := h.scopes.Lookup(name); !ok {
+			return badRequest(c, "unknown scope in allowed_scopes: "+name)
+		}
+	}
+
+	client := &model.Client{
+		ID:                     uuid.New(),
+		Name:                   req.Name,
+		Type:                   req.Type,
+		AuthMethod:             req.AuthMethod,
+		RedirectURIs:           req.RedirectURIs,
+		PostLogoutRedirectURIs: req.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:   req.BackchannelLogoutURI,
+		AllowedScopes:          req.AllowedScopes,
+		IsActive:               true,
+		CreatedAt:              time.Now().UTC(),
+	}
+
+	var secret string
+	switch client.AuthMethod {
+	case model.AuthMethodClientSecretBasic, model.AuthMethodClientSecretPost:
+		var err error
+		if secret, err = randomToken(clientSecretBytes); err != nil {
+			logger.Error("failed to generate client secret", "error", err)
+			return internalError(c, "failed to create client")
+		}
+		client.SecretHash = hashSecret(secret)
+	case model.AuthMethodPrivateKeyJWT:
+		set, err := keys.ParseJWKSet(req.JWKS)
+		if err != nil || len(set.Keys) == 0 {
+			return badRequest(c, "private_key_jwt requires a valid jwks with at least one key")
+		}
+		client.JWKS = string(req.JWKS)
+	}
 
-	clientID := uuid.New()
-	clientSecret := uuid.New().String() // placeholder
+	if err := h.repo.Clients.Create(c.Request().Context(), client); err != nil {
+		logger.Error("failed to create client", "error", err)
+		return internalError(c, "failed to create client")
+	}
 
-	logger.Info("client created", "client_id", clientID)
+	logger.Info("client created", "client_id", client.ID)
 
 	return c.JSON(http.StatusCreated, model.ClientResponse{
-		ID:           clientID,
-		Name:         req.Name,
-		Secret:       clientSecret,
-		RedirectURIs: req.RedirectURIs,
+		ID:                     client.ID,
+		Name:                   client.Name,
+		Type:                   client.Type,
+		AuthMethod:             client.AuthMethod,
+		Secret:                 secret,
+		RedirectURIs:           client.RedirectURIs,
+		PostLogoutRedirectURIs: client.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:   client.BackchannelLogoutURI,
+		AllowedScopes:          client.AllowedScopes,
+	})
+}
+
+// RotateSecret godoc
+// @Summary Rotate an OAuth client's secret
+// @Description Returns the new secret once. The previous secret keeps working
+// @Description until previous_secret_expires_at.
+// @Tags clients
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {object} model.ClientSecretResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/clients/{id}/secret/rotate [post]
+func (h *ClientHandler) RotateSecret(c echo.Context) error {
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return badRequest(c, "invalid client id")
+	}
+
+	ctx := c.Request().Context()
+
+	client, err := h.repo.Clients.GetByID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound(c, "client not found")
+		}
+		logger.Error("failed to fetch client", "error", err)
+		return internalError(c, "failed to rotate client secret")
+	}
+
+	if client.AuthMethod != model.AuthMethodClientSecretBasic && client.AuthMethod != model.AuthMethodClientSecretPost {
+		return badRequest(c, "client does not authenticate with a client secret")
+	}
+
+	secret, err := randomToken(clientSecretBytes)
+	if err != nil {
+		logger.Error("failed to generate client secret", "error", err)
+		return internalError(c, "failed to rotate client secret")
+	}
+
+	// Only the secret being replaced gets a grace period; one still pending
+	// from an earlier rotation is dropped.
+	client.PreviousSecretHash = ""
+	client.PreviousSecretExpiresAt = nil
+	if grace := h.config.OAuth.ClientSecretGracePeriod; grace > 0 && client.SecretHash != "" {
+		expiresAt := time.Now().UTC().Add(grace)
+		client.PreviousSecretHash = client.SecretHash
+		client.PreviousSecretExpiresAt = &expiresAt
+	}
+	client.SecretHash = hashSecret(secret)
+
+	if err := h.repo.Clients.UpdateSecret(ctx, client); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound(c, "client not found")
+		}
+		logger.Error("failed to rotate client secret", "error", err)
+		return internalError(c, "failed to rotate client secret")
+	}
+
+	logger.Info("client secret rotated", "client_id", client.ID)
+
+	return c.JSON(http.StatusOK, model.ClientSecretResponse{
+		ClientID:                client.ID,
+		Secret:                  secret,
+		PreviousSecretExpiresAt: client.PreviousSecretExpiresAt,
 	})
 }
 
@@ -61,11 +235,29 @@ func (h *ClientHandler) Create(c echo.Context) error {
 // @Failure 401 {object} ErrorResponse
 // @Router /api/v1/clients [get]
 func (h *ClientHandler) List(c echo.Context) error {
-	// TODO: get clients from database
+	clients, err := h.repo.Clients.List(c.Request().Context())
+	if err != nil {
+		logger.Error("failed to list clients", "error", err)
+		return internalError(c, "failed to list clients")
+	}
 
-	logger.Debug("listing clients")
+	logger.Debug("listing clients", "count", len(clients))
 
-	return c.JSON(http.StatusOK, []model.ClientResponse{})
+	resp := make([]model.ClientResponse, 0, len(clients))
+	for _, client := range clients {
+		resp = append(resp, model.ClientResponse{
+			ID:                     client.ID,
+			Name:                   client.Name,
+			Type:                   client.Type,
+			AuthMethod:             client.AuthMethod,
+			RedirectURIs:           client.RedirectURIs,
+			PostLogoutRedirectURIs: client.PostLogoutRedirectURIs,
+			BackchannelLogoutURI:   client.BackchannelLogoutURI,
+			AllowedScopes:          client.AllowedScopes,
+		})
+	}
+
+	return c.JSON(http.StatusOK, resp)
 }
 
 // Get godoc
@@ -86,14 +278,26 @@ func (h *ClientHandler) Get(c echo.Context) error {
 		return badRequest(c, "invalid client id")
 	}
 
-	// TODO: get client from database
-
 	logger.Debug("fetching client", "client_id", clientID)
 
+	client, err := h.repo.Clients.GetByID(c.Request().Context(), clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound(c, "client not found")
+		}
+		logger.Error("failed to fetch client", "error", err)
+		return internalError(c, "failed to fetch client")
+	}
+
 	return c.JSON(http.StatusOK, model.ClientResponse{
-		ID:           clientID,
-		Name:         "Example Client",
-		RedirectURIs: []string{"https://example.com/callback"},
+		ID:                     client.ID,
+		Name:                   client.Name,
+		Type:                   client.Type,
+		AuthMethod:             client.AuthMethod,
+		RedirectURIs:           client.RedirectURIs,
+		PostLogoutRedirectURIs: client.PostLogoutRedirectURIs,
+		BackchannelLogoutURI:   client.BackchannelLogoutURI,
+		AllowedScopes:          client.AllowedScopes,
 	})
 }
 
@@ -114,9 +318,52 @@ func (h *ClientHandler) Delete(c echo.Context) error {
 		return badRequest(c, "invalid client id")
 	}
 
-	// TODO: delete client from database
+	if err := h.repo.Clients.Delete(c.Request().Context(), clientID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound(c, "client not found")
+		}
+		logger.Error("failed to delete client", "error", err)
+		return internalError(c, "failed to delete client")
+	}
 
 	logger.Info("client deleted", "client_id", clientID)
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// ListLogoutDeliveries godoc
+// @Summary List an OAuth client's back-channel logout deliveries
+// @Description Returns the most recent logout tokens sent, or still to be
+// @Description sent, to the client's backchannel_logout_uri, newest first.
+// @Tags clients
+// @Security BearerAuth
+// @Produce json
+// @Param id path string true "Client ID"
+// @Success 200 {array} model.LogoutDelivery
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/clients/{id}/logout-deliveries [get]
+func (h *ClientHandler) ListLogoutDeliveries(c echo.Context) error {
+	clientID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return badRequest(c, "invalid client id")
+	}
+
+	ctx := c.Request().Context()
+
+	if _, err := h.repo.Clients.GetByID(ctx, clientID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound(c, "client not found")
+		}
+		logger.Error("failed to fetch client", "error", err)
+		return internalError(c, "failed to list logout deliveries")
+	}
+
+	deliveries, err := h.repo.LogoutDeliveries.ListByClientID(ctx, clientID, logoutDeliveryLimit)
+	if err != nil {
+		logger.Error("failed to list logout deliveries", "error", err)
+		return internalError(c, "failed to list logout deliveries")
+	}
+
+	return c.JSON(http.StatusOK, deliveries)
+}
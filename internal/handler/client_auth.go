@@ -0,0 +1,255 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	clientAssertionTypeJWT = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// maxAssertionLifetime caps how long a client assertion is valid for, and
+	// so how long its jti has to be remembered.
+	maxAssertionLifetime = 5 * time.Minute
+	// assertionLeeway allows for clock skew between the client and the server.
+	assertionLeeway = 5 * time.Second
+)
+
+// errClientAuth is returned when a client fails to authenticate. Its message
+// is safe to return to the caller as error_description.
+type errClientAuth struct {
+	description string
+}
+
+func (e *errClientAuth) Error() string {
+	return e.description
+}
+
+func clientAuthFailed(format string, args ...any) error {
+	return &errClientAuth{description: fmt.Sprintf(format, args...)}
+}
+
+// clientCredentials are the credentials presented on a request, whichever
+// method carried them.
+type clientCredentials struct {
+	method    string
+	clientID  string
+	secret    string
+	assertion string
+}
+
+// authenticateClient authenticates the client calling the token, revocation
+// or introspection endpoint using the method the client registered. An
+// *errClientAuth means the client should receive invalid_client; any other
+// error is an internal failure.
+func (h *OAuthHandler) authenticateClient(c echo.Context) (*model.Client, error) {
+	creds, err := readClientCredentials(c)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := h.findClient(c, creds.clientID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, clientAuthFailed("unknown client")
+	}
+
+	if creds.method != client.AuthMethod {
+		return nil, clientAuthFailed("client must authenticate with %s", client.AuthMethod)
+	}
+
+	switch creds.method {
+	case model.AuthMethodClientSecretBasic, model.AuthMethodClientSecretPost:
+		if !checkClientSecret(client, creds.secret) {
+			return nil, clientAuthFailed("client authentication failed")
+		}
+	case model.AuthMethodPrivateKeyJWT:
+		claims, err := h.verifyClientAssertion(c, client, creds.assertion)
+		if err != nil {
+			return nil, clientAuthFailed("invalid client assertion: %v", err)
+		}
+		if err := h.useClientAssertion(c, client, claims); err != nil {
+			return nil, err
+		}
+	case model.AuthMethodNone:
+		// Public clients prove possession through PKCE instead.
+	}
+
+	return client, nil
+}
+
+// checkClientSecret accepts the current secret, or the previous one while its
+// grace period after a rotation lasts.
+func checkClientSecret(client *model.Client, secret string) bool {
+	hash := []byte(hashSecret(secret))
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(client.SecretHash), hash) == 1 {
+		return true
+	}
+	if client.PreviousSecretHash == "" || client.PreviousSecretExpiresAt == nil || !time.Now().Before(*client.PreviousSecretExpiresAt) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(client.PreviousSecretHash), hash) == 1
+}
+
+// readClientCredentials detects the authentication method from the request.
+// Exactly one method may be used per request (RFC 6749, section 2.3).
+func readClientCredentials(c echo.Context) (*clientCredentials, error) {
+	var found []*clientCredentials
+
+	if id, secret, ok := c.Request().BasicAuth(); ok {
+		// Basic credentials are form-urlencoded before being base64 encoded.
+		id, err := url.QueryUnescape(id)
+		if err != nil {
+			return nil, clientAuthFailed("malformed basic credentials")
+		}
+		secret, err := url.QueryUnescape(secret)
+		if err != nil {
+			return nil, clientAuthFailed("malformed basic credentials")
+		}
+		found = append(found, &clientCredentials{method: model.AuthMethodClientSecretBasic, clientID: id, secret: secret})
+	}
+
+	if assertion := c.FormValue("client_assertion"); assertion != "" {
+		if c.FormValue("client_assertion_type") != clientAssertionTypeJWT {
+			return nil, clientAuthFailed("unsupported client_assertion_type")
+		}
+		subject, err := assertionSubject(assertion)
+		if err != nil {
+			return nil, clientAuthFailed("malformed client assertion")
+		}
+		if id := c.FormValue("client_id"); id != "" && id != subject {
+			return nil, clientAuthFailed("client_id does not match client assertion")
+		}
+		found = append(found, &clientCredentials{method: model.AuthMethodPrivateKeyJWT, clientID: subject, assertion: assertion})
+	} else if secret := c.FormValue("client_secret"); secret != "" {
+		found = append(found, &clientCredentials{method: model.AuthMethodClientSecretPost, clientID: c.FormValue("client_id"), secret: secret})
+	}
+
+	switch len(found) {
+	case 0:
+		if id := c.FormValue("client_id"); id != "" {
+			return &clientCredentials{method: model.AuthMethodNone, clientID: id}, nil
+		}
+		return nil, clientAuthFailed("client credentials required")
+	case 1:
+		return found[0], nil
+	default:
+		return nil, clientAuthFailed("multiple client authentication methods used")
+	}
+}
+
+// assertionSubject reads the unverified sub claim to find the client.
+func assertionSubject(assertion string) (string, error) {
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(assertion, &claims); err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", errors.New("missing sub")
+	}
+	return claims.Subject, nil
+}
+
+// verifyClientAssertion validates a private_key_jwt assertion (RFC 7523)
+// against the client's registered keys. Assertions must carry a jti and be
+// valid for no longer than maxAssertionLifetime.
+func (h *OAuthHandler) verifyClientAssertion(c echo.Context, client *model.Client, assertion string) (*jwt.RegisteredClaims, error) {
+	set, err := keys.ParseJWKSet([]byte(client.JWKS))
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := strings.TrimSuffix(h.config.JWT.Issuer, "/")
+	audiences := []string{h.config.JWT.Issuer, issuer + c.Path()}
+
+	claims := jwt.RegisteredClaims{}
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{keys.RS256, keys.ES256, keys.EdDSA}),
+		jwt.WithIssuer(client.ID.String()),
+		jwt.WithSubject(client.ID.String()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(assertionLeeway),
+	)
+	_, err = parser.ParseWithClaims(assertion, &claims, func(t *jwt.Token) (any, error) {
+		// Without a kid, every registered key that fits the algorithm is tried.
+		kid, _ := t.Header["kid"].(string)
+		var candidates jwt.VerificationKeySet
+		for _, k := range set.Keys {
+			if (kid != "" && k.Kid != kid) || !k.UsableFor(t.Method.Alg()) {
+				continue
+			}
+			pub, err := k.PublicKey()
+			if err != nil {
+				return nil, err
+			}
+			candidates.Keys = append(candidates.Keys, pub)
+		}
+		if len(candidates.Keys) == 0 {
+			return nil, keys.ErrKeyNotFound
+		}
+		return candidates, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !audienceMatches(claims.Audience, audiences) {
+		return nil, errors.New("audience does not include this server")
+	}
+	if claims.ID == "" {
+		return nil, errors.New("missing jti")
+	}
+
+	expiresAt := claims.ExpiresAt.Time
+	if time.Until(expiresAt) > maxAssertionLifetime ||
+		(claims.IssuedAt != nil && expiresAt.Sub(claims.IssuedAt.Time) > maxAssertionLifetime) {
+		return nil, fmt.Errorf("assertion must not be valid for more than %s", maxAssertionLifetime)
+	}
+	return &claims, nil
+}
+
+func audienceMatches(got, want []string) bool {
+	for _, aud := range got {
+		for _, w := range want {
+			if aud == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// useClientAssertion records the jti of a verified assertion until it expires
+// and rejects an assertion whose jti the client has already used.
+func (h *OAuthHandler) useClientAssertion(c echo.Context, client *model.Client, claims *jwt.RegisteredClaims) error {
+	ctx := c.Request().Context()
+
+	err := h.repo.ClientAssertions.Use(ctx, client.ID, claims.ID, claims.ExpiresAt.Add(assertionLeeway))
+	if errors.Is(err, repository.ErrConflict) {
+		logger.Warn("client assertion replayed", "client_id", client.ID)
+		return clientAuthFailed("invalid client assertion: already used")
+	}
+	if err != nil {
+		logger.Error("failed to record client assertion", "error", err)
+		return err
+	}
+
+	// Entries are only needed until the assertion would have expired anyway.
+	if err := h.repo.ClientAssertions.DeleteExpired(ctx, time.Now().UTC()); err != nil {
+		logger.Error("failed to prune client assertions", "error", err)
+	}
+	return nil
+}
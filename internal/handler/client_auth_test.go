@@ -0,0 +1,229 @@
+package handler
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+type assertionFixture struct {
+	handler *OAuthHandler
+	client  *model.Client
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+}
+
+// setupAssertions registers a private_key_jwt client with an RSA key followed
+// by an EC key, neither of which has a kid.
+func setupAssertions(t *testing.T) *assertionFixture {
+	t.Helper()
+	repo := setup(t)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	jwks, err := json.Marshal(keys.JWKSet{Keys: []keys.JWK{
+		{
+			Kty: "RSA",
+			N:   b64(rsaKey.N.Bytes()),
+			E:   b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		},
+		{
+			Kty: "EC",
+			Crv: "P-256",
+			X:   b64(ecKey.X.FillBytes(make([]byte, 32))),
+			Y:   b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := createClient(t, repo, &model.Client{AuthMethod: model.AuthMethodPrivateKeyJWT, JWKS: string(jwks)})
+	return &assertionFixture{
+		handler: &OAuthHandler{config: &config.Config{JWT: config.JWTConfig{Issuer: issuer}}, repo: repo},
+		client:  client,
+		rsaKey:  rsaKey,
+		ecKey:   ecKey,
+	}
+}
+
+// claims returns valid assertion claims for the client.
+func (f *assertionFixture) claims() jwt.RegisteredClaims {
+	now := time.Now()
+	return jwt.RegisteredClaims{
+		Issuer:    f.client.ID.String(),
+		Subject:   f.client.ID.String(),
+		Audience:  jwt.ClaimStrings{issuer + "/oauth/token"},
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        uuid.NewString(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key crypto.Signer, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestVerifyClientAssertion(t *testing.T) {
+	f := setupAssertions(t)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		key    crypto.Signer
+		modify func(*jwt.RegisteredClaims)
+		valid  bool
+	}{
+		{"RSA key", jwt.SigningMethodRS256, f.rsaKey, nil, true},
+		// The EC key is registered after the RSA key, and the assertion has no
+		// kid to pick it.
+		{"EC key without kid", jwt.SigningMethodES256, f.ecKey, nil, true},
+		{"issuer as audience", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{issuer}
+		}, true},
+
+		{"unregistered key", jwt.SigningMethodES256, otherKey, nil, false},
+		{"algorithm not allowed", jwt.SigningMethodPS256, f.rsaKey, nil, false},
+		{"other audience", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.Audience = jwt.ClaimStrings{"https://other.test/oauth/token"}
+		}, false},
+		{"missing audience", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.Audience = nil
+		}, false},
+		{"other issuer", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.Issuer = uuid.NewString()
+		}, false},
+		{"other subject", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.Subject = uuid.NewString()
+		}, false},
+		{"expired", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(-2 * time.Minute))
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+		}, false},
+		{"missing expiry", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		}, false},
+		{"expires too late", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.IssuedAt = nil
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(maxAssertionLifetime + time.Minute))
+		}, false},
+		{"lifetime too long", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(-maxAssertionLifetime))
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(time.Minute))
+		}, false},
+		{"issued in the future", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute))
+		}, false},
+		{"missing jti", jwt.SigningMethodES256, f.ecKey, func(c *jwt.RegisteredClaims) {
+			c.ID = ""
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := f.claims()
+			if tt.modify != nil {
+				tt.modify(&claims)
+			}
+			_, err := f.handler.verifyClientAssertion(tokenContext(), f.client, sign(t, tt.method, tt.key, claims))
+			if tt.valid && err != nil {
+				t.Errorf("assertion rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("assertion accepted")
+			}
+		})
+	}
+}
+
+func TestVerifyClientAssertionByKid(t *testing.T) {
+	f := setupAssertions(t)
+
+	// A kid selects the key, so one naming the RSA key rejects an EC signature.
+	set, err := keys.ParseJWKSet([]byte(f.client.JWKS))
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Keys[0].Kid, set.Keys[1].Kid = "rsa", "ec"
+	jwks, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.client.JWKS = string(jwks)
+
+	for kid, valid := range map[string]bool{"ec": true, "rsa": false, "unknown": false} {
+		tok := jwt.NewWithClaims(jwt.SigningMethodES256, f.claims())
+		tok.Header["kid"] = kid
+		signed, err := tok.SignedString(f.ecKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.handler.verifyClientAssertion(tokenContext(), f.client, signed)
+		if valid != (err == nil) {
+			t.Errorf("kid %q: err = %v, want valid = %v", kid, err, valid)
+		}
+	}
+}
+
+func TestClientAssertionReplay(t *testing.T) {
+	f := setupAssertions(t)
+	c := tokenContext()
+	assertion := sign(t, jwt.SigningMethodES256, f.ecKey, f.claims())
+
+	claims, err := f.handler.verifyClientAssertion(c, f.client, assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.handler.useClientAssertion(c, f.client, claims); err != nil {
+		t.Fatalf("first use rejected: %v", err)
+	}
+
+	claims, err = f.handler.verifyClientAssertion(c, f.client, assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var authErr *errClientAuth
+	if err := f.handler.useClientAssertion(c, f.client, claims); !errors.As(err, &authErr) {
+		t.Fatalf("replay: err = %v, want a client authentication failure", err)
+	}
+
+	// The jti is remembered per client.
+	other := createClient(t, f.handler.repo, &model.Client{AuthMethod: model.AuthMethodPrivateKeyJWT, JWKS: f.client.JWKS})
+	claims.Issuer, claims.Subject = other.ID.String(), other.ID.String()
+	if err := f.handler.useClientAssertion(c, other, claims); err != nil {
+		t.Errorf("same jti from another client rejected: %v", err)
+	}
+}
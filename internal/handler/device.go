@@ -0,0 +1,389 @@
+package handler
+
+import (
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	grantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// userCodeAlphabet avoids vowels and look-alike characters so user codes
+	// are easy to type and never spell words (RFC 8628, section 6.1).
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+
+	// slowDownIncrement is added to the polling interval each time a client
+	// polls too fast (RFC 8628, section 3.5).
+	slowDownIncrement = 5 * time.Second
+)
+
+// DeviceAuthorization godoc
+// @Summary OAuth2 device authorization endpoint (RFC 8628)
+// @Tags oauth
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param client_id formData string false "Client ID"
+// @Param scope formData string false "Requested scope"
+// @Success 200 {object} model.DeviceAuthorizationResponse
+// @Failure 400 {object} OAuthErrorResponse
+// @Failure 401 {object} OAuthErrorResponse
+// @Router /oauth/device_authorization [post]
+func (h *OAuthHandler) DeviceAuthorization(c echo.Context) error {
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return clientAuthError(c, err)
+	}
+
+	scopes := strings.Fields(c.FormValue("scope"))
+	if err := h.scopes.Validate(scopes, client.AllowedScopes); err != nil {
+		return oauthError(c, "invalid_scope", err.Error())
+	}
+
+	deviceCode, err := randomToken(32)
+	if err != nil {
+		logger.Error("failed to generate device code", "error", err)
+		return internalError(c, "failed to start device authorization")
+	}
+
+	now := time.Now().UTC()
+	dc := &model.DeviceCode{
+		DeviceCodeHash: hashSecret(deviceCode),
+		ClientID:       client.ID,
+		Scope:          strings.Join(scopes, " "),
+		Status:         model.DeviceCodePending,
+		Interval:       h.config.OAuth.DevicePollInterval,
+		ExpiresAt:      now.Add(h.config.OAuth.DeviceCodeExpiry),
+		CreatedAt:      now,
+	}
+
+	// User codes are short, so retry on the rare collision with a live one.
+	for attempt := 0; ; attempt++ {
+		if dc.UserCode, err = generateUserCode(); err != nil {
+			logger.Error("failed to generate user code", "error", err)
+			return internalError(c, "failed to start device authorization")
+		}
+		err = h.repo.DeviceCodes.Create(c.Request().Context(), dc)
+		if err == nil || !errors.Is(err, repository.ErrConflict) || attempt == 2 {
+			break
+		}
+	}
+	if err != nil {
+		logger.Error("failed to store device code", "error", err)
+		return internalError(c, "failed to start device authorization")
+	}
+
+	logger.Info("device authorization started", "client_id", client.ID)
+
+	verificationURI := strings.TrimSuffix(h.config.JWT.Issuer, "/") + "/oauth/device"
+
+	noStore(c)
+	return c.JSON(http.StatusOK, model.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                dc.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + dc.UserCode,
+		ExpiresIn:               int(h.config.OAuth.DeviceCodeExpiry.Seconds()),
+		Interval:                int(dc.Interval.Seconds()),
+	})
+}
+
+type devicePage struct {
+	Title      string
+	Error      string
+	UserCode   string
+	ClientName string
+	Scopes     []scope.Scope
+	Result     string
+	CSRF       string
+}
+
+// DeviceVerification godoc
+// @Summary Device verification page
+// @Description Lets a logged-in user enter the code shown on their device.
+// @Tags oauth
+// @Produce html
+// @Param user_code query string false "User code, when opened from verification_uri_complete"
+// @Success 200
+// @Success 302 "Redirect to /login when not signed in"
+// @Router /oauth/device [get]
+func (h *OAuthHandler) DeviceVerification(c echo.Context) error {
+	page := &devicePage{Title: "Connect a device", CSRF: middleware.CSRFToken(c)}
+
+	if _, ok := middleware.UserID(c); !ok {
+		return redirectToLogin(c, c.Request().RequestURI, nil)
+	}
+
+	userCode := c.QueryParam("user_code")
+	if userCode == "" {
+		return render(c, http.StatusOK, "device.html", page)
+	}
+
+	// Coming from verification_uri_complete: ask for confirmation straight away.
+	return h.showDeviceRequest(c, page, userCode)
+}
+
+// DeviceVerificationSubmit godoc
+// @Summary Submit a user code, then approve or deny the device
+// @Tags oauth
+// @Accept application/x-www-form-urlencoded
+// @Produce html
+// @Param user_code formData string true "User code"
+// @Param action formData string false "approve or deny; empty to look up the code"
+// @Success 200
+// @Router /oauth/device [post]
+func (h *OAuthHandler) DeviceVerificationSubmit(c echo.Context) error {
+	page := &devicePage{Title: "Connect a device", CSRF: middleware.CSRFToken(c)}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		// The session expired while the page was open; start over after login.
+		return redirectToLogin(c, "/oauth/device", nil)
+	}
+
+	action := c.FormValue("action")
+	if action == "" {
+		return h.showDeviceRequest(c, page, c.FormValue("user_code"))
+	}
+
+	dc, err := h.findDeviceCode(c, c.FormValue("user_code"))
+	if err != nil {
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "device.html", page)
+	}
+	if dc == nil {
+		page.Error = "That code is invalid or has expired."
+		return render(c, http.StatusBadRequest, "device.html", page)
+	}
+
+	switch action {
+	case "approve":
+		authTime, amr, acr, err := h.authContext(c)
+		if err != nil {
+			page.Error = "Something went wrong. Please try again."
+			return render(c, http.StatusInternalServerError, "device.html", page)
+		}
+		// Approving on this page is the user's consent, so remember it.
+		if err := h.grantScopes(c, userID, dc.ClientID, strings.Fields(dc.Scope)); err != nil {
+			page.Error = "Something went wrong. Please try again."
+			return render(c, http.StatusInternalServerError, "device.html", page)
+		}
+		dc.Status = model.DeviceCodeApproved
+		dc.UserID = uuid.NullUUID{UUID: userID, Valid: true}
+		dc.SessionID = browserSessionID(c)
+		dc.AuthTime, dc.AMR, dc.ACR = authTime, amr, acr
+	case "deny":
+		dc.Status = model.DeviceCodeDenied
+	default:
+		page.Error = "Unknown action."
+		return render(c, http.StatusBadRequest, "device.html", page)
+	}
+
+	if err := h.repo.DeviceCodes.Decide(c.Request().Context(), dc); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			page.Error = "That code is invalid or has expired."
+			return render(c, http.StatusBadRequest, "device.html", page)
+		}
+		logger.Error("failed to record device decision", "error", err)
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "device.html", page)
+	}
+
+	logger.Info("device authorization decided", "client_id", dc.ClientID, "user_id", userID, "status", dc.Status)
+
+	page.Result = dc.Status
+	return render(c, http.StatusOK, "device.html", page)
+}
+
+// showDeviceRequest renders the confirmation step for a user code, or the
+// entry form with an error when the code is not usable.
+func (h *OAuthHandler) showDeviceRequest(c echo.Context, page *devicePage, userCode string) error {
+	dc, err := h.findDeviceCode(c, userCode)
+	if err != nil {
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "device.html", page)
+	}
+	if dc == nil {
+		page.Error = "That code is invalid or has expired."
+		return render(c, http.StatusBadRequest, "device.html", page)
+	}
+
+	client, err := h.repo.Clients.GetByID(c.Request().Context(), dc.ClientID)
+	if err != nil {
+		logger.Error("failed to fetch client", "error", err)
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "device.html", page)
+	}
+
+	page.UserCode = dc.UserCode
+	page.ClientName = client.Name
+	page.Scopes = h.scopes.Describe(strings.Fields(dc.Scope))
+	return render(c, http.StatusOK, "device.html", page)
+}
+
+// findDeviceCode returns the pending, unexpired request for a user code, or
+// nil if there is none. A non-nil error has been logged.
+func (h *OAuthHandler) findDeviceCode(c echo.Context, userCode string) (*model.DeviceCode, error) {
+	userCode = normalizeUserCode(userCode)
+	if userCode == "" {
+		return nil, nil
+	}
+
+	dc, err := h.repo.DeviceCodes.GetByUserCode(c.Request().Context(), userCode)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to fetch device code", "error", err)
+		return nil, err
+	}
+	if dc.Status != model.DeviceCodePending || time.Now().After(dc.ExpiresAt) {
+		return nil, nil
+	}
+	return dc, nil
+}
+
+// handleDeviceCode answers a device's token poll (RFC 8628, section 3.4).
+func (h *OAuthHandler) handleDeviceCode(c echo.Context, client *model.Client) error {
+	deviceCode := c.FormValue("device_code")
+	if deviceCode == "" {
+		return oauthError(c, "invalid_request", "device_code required")
+	}
+
+	ctx := c.Request().Context()
+	hash := hashSecret(deviceCode)
+
+	dc, err := h.repo.DeviceCodes.GetByDeviceCodeHash(ctx, hash)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return oauthError(c, "invalid_grant", "invalid device code")
+		}
+		logger.Error("failed to fetch device code", "error", err)
+		return internalError(c, "failed to exchange device code")
+	}
+	if dc.ClientID != client.ID {
+		return oauthError(c, "invalid_grant", "device code was not issued to this client")
+	}
+
+	now := time.Now().UTC()
+	if now.After(dc.ExpiresAt) {
+		if err := h.repo.DeviceCodes.Delete(ctx, hash); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to delete device code", "error", err)
+		}
+		return oauthError(c, "expired_token", "device code expired")
+	}
+
+	switch dc.Status {
+	case model.DeviceCodePending:
+		tooFast := dc.LastPolledAt != nil && now.Sub(*dc.LastPolledAt) < dc.Interval
+		if tooFast {
+			dc.Interval += slowDownIncrement
+		}
+		dc.LastPolledAt = &now
+		if err := h.repo.DeviceCodes.UpdatePoll(ctx, dc); err != nil {
+			logger.Error("failed to record device poll", "error", err)
+			return internalError(c, "failed to exchange device code")
+		}
+		if tooFast {
+			return oauthError(c, "slow_down", "polling too frequently")
+		}
+		return oauthError(c, "authorization_pending", "the user has not yet approved the device")
+
+	case model.DeviceCodeDenied:
+		if err := h.repo.DeviceCodes.Delete(ctx, hash); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to delete device code", "error", err)
+		}
+		return oauthError(c, "access_denied", "the user denied the request")
+	}
+
+	if err := h.scopes.Validate(strings.Fields(dc.Scope), client.AllowedScopes); err != nil {
+		return oauthError(c, "invalid_scope", err.Error())
+	}
+
+	// Approved: only the poll that deletes the code may redeem it.
+	if err := h.repo.DeviceCodes.Delete(ctx, hash); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return oauthError(c, "invalid_grant", "device code already used")
+		}
+		logger.Error("failed to delete device code", "error", err)
+		return internalError(c, "failed to exchange device code")
+	}
+
+	active, err := h.parentSessionActive(c, dc.SessionID, dc.UserID.UUID)
+	if err != nil {
+		return internalError(c, "failed to exchange device code")
+	}
+	if !active {
+		return oauthError(c, "invalid_grant", "the user has signed out")
+	}
+
+	resp, err := h.startSession(c, client, &model.Session{
+		UserID:   dc.UserID.UUID,
+		ParentID: dc.SessionID,
+		Scope:    dc.Scope,
+		AuthTime: dc.AuthTime,
+		AMR:      dc.AMR,
+		ACR:      dc.ACR,
+	}, "")
+	if err != nil {
+		return internalError(c, "failed to exchange device code")
+	}
+
+	logger.Info("oauth token exchange", "grant_type", grantTypeDeviceCode, "client_id", client.ID)
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// generateUserCode returns a random code formatted as XXXX-XXXX.
+func generateUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength)
+	buf := make([]byte, userCodeLength*2)
+	for len(code) < userCodeLength {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			// Reject bytes that would bias the modulo.
+			if int(b) >= 256-256%len(userCodeAlphabet) {
+				continue
+			}
+			code = append(code, userCodeAlphabet[int(b)%len(userCodeAlphabet)])
+			if len(code) == userCodeLength {
+				break
+			}
+		}
+	}
+	return formatUserCode(string(code)), nil
+}
+
+// normalizeUserCode accepts codes typed in any case and with or without
+// separators, and returns the stored form or "" if the input cannot match.
+func normalizeUserCode(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			b.WriteRune(r)
+		} else if r != '-' && r != ' ' {
+			return ""
+		}
+	}
+	if b.Len() != userCodeLength {
+		return ""
+	}
+	return formatUserCode(b.String())
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
@@ -1,22 +1,49 @@
 package handler
 
-import "github.com/labstack/echo/v4"
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/ali/sso-server/internal/token"
+	"github.com/labstack/echo/v4"
+)
 
 type Handler struct {
-	Health *HealthHandler
-	Auth   *AuthHandler
-	User   *UserHandler
-	Client *ClientHandler
-	OAuth  *OAuthHandler
+	Health    *HealthHandler
+	Auth      *AuthHandler
+	User      *UserHandler
+	Client    *ClientHandler
+	OAuth     *OAuthHandler
+	WellKnown *WellKnownHandler
+
+	auth     *middleware.Auth
+	sessions *middleware.Sessions
+	csrf     echo.MiddlewareFunc
 }
 
-func New() *Handler {
+func New(cfg *config.Config, repo *repository.Repository, keyManager *keys.Manager, tokens *token.Service, scopes *scope.Registry, logouts *backchannel.Notifier) *Handler {
+	auth := middleware.NewAuth(tokens, repo)
+	sessions := middleware.NewSessions(cfg.Session, repo, logouts)
+
 	return &Handler{
-		Health: NewHealthHandler(),
-		Auth:   NewAuthHandler(),
-		User:   NewUserHandler(),
-		Client: NewClientHandler(),
-		OAuth:  NewOAuthHandler(),
+		Health:    NewHealthHandler(),
+		Auth:      NewAuthHandler(cfg, repo, tokens, sessions, logouts),
+		User:      NewUserHandler(cfg, repo, logouts),
+		Client:    NewClientHandler(cfg, repo, scopes),
+		OAuth:     NewOAuthHandler(cfg, repo, tokens, auth, sessions, logouts, scopes),
+		WellKnown: NewWellKnownHandler(cfg, keyManager, scopes),
+		auth:      auth,
+		sessions:  sessions,
+		csrf:      middleware.CSRF(cfg.Session),
 	}
 }
 
@@ -24,6 +51,11 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 	// Health check
 	e.GET("/health", h.Health.Health)
 
+	// Discovery
+	wellKnown := e.Group("/.well-known")
+	wellKnown.GET("/openid-configuration", h.WellKnown.OpenIDConfiguration)
+	wellKnown.GET("/jwks.json", h.WellKnown.JWKS)
+
 	// API v1 routes
 	v1 := e.Group("/api/v1")
 
@@ -32,27 +64,66 @@ func (h *Handler) RegisterRoutes(e *echo.Echo) {
 	auth.POST("/register", h.Auth.Register)
 	auth.POST("/login", h.Auth.Login)
 	auth.POST("/refresh", h.Auth.Refresh)
-	auth.POST("/logout", h.Auth.Logout) // TODO: add auth middleware
+	auth.POST("/logout", h.Auth.Logout, h.auth.Required())
 
-	// User routes (protected)
-	users := v1.Group("/users")
-	// TODO: add auth middleware
+	// User routes (protected). Only first-party tokens may manage the account;
+	// clients acting for the user have /oauth/userinfo.
+	users := v1.Group("/users", h.auth.Required(), middleware.RequireScope(scope.Account))
 	users.GET("/me", h.User.GetMe)
 	users.PATCH("/me", h.User.UpdateMe)
 	users.PUT("/me/password", h.User.ChangePassword)
+	users.POST("/me/totp", h.User.EnrollTOTP)
+	users.POST("/me/totp/confirm", h.User.ConfirmTOTP)
+	users.DELETE("/me/totp", h.User.DisableTOTP)
+	users.GET("/me/grants", h.User.ListGrants)
+	users.DELETE("/me/grants/:client_id", h.User.RevokeGrant)
+
+	// Client routes (admin protected). The role alone is not enough: an
+	// admin's token issued to some OAuth client must not manage clients.
+	clients := v1.Group("/clients", h.auth.Required(), middleware.RequireScope(scope.Account))
+	canRead := h.auth.RequirePermission(model.PermissionClientsRead)
+	canWrite := h.auth.RequirePermission(model.PermissionClientsWrite)
+	clients.POST("", h.Client.Create, canWrite)
+	clients.GET("", h.Client.List, canRead)
+	clients.GET("/:id", h.Client.Get, canRead)
+	clients.DELETE("/:id", h.Client.Delete, canWrite)
+	clients.POST("/:id/secret/rotate", h.Client.RotateSecret, canWrite)
+	clients.GET("/:id/logout-deliveries", h.Client.ListLogoutDeliveries, canRead)
 
-	// Client routes (admin protected)
-	clients := v1.Group("/clients")
-	// TODO: add admin auth middleware
-	clients.POST("", h.Client.Create)
-	clients.GET("", h.Client.List)
-	clients.GET("/:id", h.Client.Get)
-	clients.DELETE("/:id", h.Client.Delete)
+	// Browser sign-in (server-rendered)
+	e.GET("/login", h.Auth.LoginPage, h.sessions.Load(), h.csrf)
+	e.POST("/login", h.Auth.LoginSubmit, h.sessions.Load(), h.csrf)
+	e.GET("/login/mfa", h.Auth.MFAPage, h.sessions.Load(), h.csrf)
+	e.POST("/login/mfa", h.Auth.MFASubmit, h.sessions.Load(), h.csrf)
 
 	// OAuth routes
 	oauth := e.Group("/oauth")
-	oauth.GET("/authorize", h.OAuth.Authorize)
+	oauth.GET("/authorize", h.OAuth.Authorize, h.sessions.Load(), h.csrf)
+	oauth.POST("/authorize", h.OAuth.AuthorizeDecision, h.sessions.Load(), h.csrf)
 	oauth.POST("/token", h.OAuth.Token)
+	oauth.POST("/device_authorization", h.OAuth.DeviceAuthorization)
+	oauth.GET("/device", h.OAuth.DeviceVerification, h.sessions.Load(), h.csrf)
+	oauth.POST("/device", h.OAuth.DeviceVerificationSubmit, h.sessions.Load(), h.csrf)
 	oauth.POST("/revoke", h.OAuth.Revoke)
-	oauth.GET("/userinfo", h.OAuth.UserInfo) // TODO: add auth middleware
+	oauth.POST("/introspect", h.OAuth.Introspect)
+	oauth.GET("/userinfo", h.OAuth.UserInfo, h.auth.Required())
+	oauth.GET("/logout", h.OAuth.Logout, h.sessions.Load(), h.csrf)
+	oauth.POST("/logout", h.OAuth.LogoutConfirm, h.sessions.Load(), h.csrf)
+}
+
+// randomToken returns a URL-safe random string with n bytes of entropy.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret returns the SHA-256 hex digest used to store high-entropy
+// secrets such as client secrets. A fast hash is sufficient because the
+// secrets are random rather than user-chosen.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
 }
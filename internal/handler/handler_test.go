@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/database"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const issuer = "https://sso.test"
+
+func setup(t *testing.T) *repository.Repository {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := logger.Init(logger.Config{Level: "error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Open(config.DatabaseConfig{Driver: database.DriverSQLite, DSN: t.TempDir() + "/sso.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := database.NewMigrator(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := repository.New(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+func createClient(t *testing.T, repo *repository.Repository, client *model.Client) *model.Client {
+	t.Helper()
+	client.ID = uuid.New()
+	client.Name = "App"
+	client.Type = model.ClientTypeConfidential
+	client.RedirectURIs = []string{"https://app.test/cb"}
+	client.IsActive = true
+	client.CreatedAt = time.Now().UTC()
+	if err := repo.Clients.Create(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+// tokenContext returns a context for a request to the token endpoint.
+func tokenContext() echo.Context {
+	c := echo.New().NewContext(httptest.NewRequest("POST", "/oauth/token", nil), httptest.NewRecorder())
+	c.SetPath("/oauth/token")
+	return c
+}
@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/token"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	tokenTypeHintAccessToken  = "access_token"
+	tokenTypeHintRefreshToken = "refresh_token"
+)
+
+// Introspect godoc
+// @Summary OAuth2 token introspection (RFC 7662)
+// @Description Reports whether an access or refresh token is active. Inactive,
+// @Description unknown, revoked and expired tokens all return {"active": false}.
+// @Tags oauth
+// @Accept application/x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to introspect"
+// @Param token_type_hint formData string false "Token type hint (access_token or refresh_token)"
+// @Success 200 {object} model.IntrospectionResponse
+// @Failure 400 {object} OAuthErrorResponse
+// @Failure 401 {object} OAuthErrorResponse
+// @Router /oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c echo.Context) error {
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return clientAuthError(c, err)
+	}
+	if client.IsPublic() {
+		return oauthError(c, "invalid_client", "public clients cannot introspect tokens")
+	}
+
+	tok := c.FormValue("token")
+	if tok == "" {
+		return oauthError(c, "invalid_request", "token required")
+	}
+
+	// The hint only decides which lookup runs first (RFC 7662, section 2.1).
+	lookups := []func(echo.Context, *model.Client, string) (*model.IntrospectionResponse, error){
+		h.introspectAccessToken, h.introspectRefreshToken,
+	}
+	if c.FormValue("token_type_hint") == tokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	resp := &model.IntrospectionResponse{}
+	for _, lookup := range lookups {
+		found, err := lookup(c, client, tok)
+		if err != nil {
+			return internalError(c, "failed to introspect token")
+		}
+		if found != nil {
+			resp = found
+			break
+		}
+	}
+
+	logger.Debug("oauth token introspected", "client_id", client.ID, "active", resp.Active)
+
+	noStore(c)
+	return c.JSON(http.StatusOK, resp)
+}
+
+// introspectAccessToken returns nil if tok is not a valid access token. A
+// revoked token, or one whose session has ended or whose user is inactive, is
+// reported as inactive.
+func (h *OAuthHandler) introspectAccessToken(c echo.Context, _ *model.Client, tok string) (*model.IntrospectionResponse, error) {
+	p, err := h.auth.Verify(c.Request().Context(), tok)
+	switch {
+	case err == nil:
+	case errors.Is(err, middleware.ErrTokenRevoked), errors.Is(err, middleware.ErrSessionEnded), errors.Is(err, middleware.ErrUserInactive):
+		return &model.IntrospectionResponse{}, nil
+	case errors.Is(err, token.ErrInvalidToken), errors.Is(err, token.ErrExpiredToken):
+		return nil, nil
+	default:
+		logger.Error("failed to verify access token", "error", err)
+		return nil, err
+	}
+
+	claims := p.Claims
+	resp := &model.IntrospectionResponse{
+		Active:    true,
+		Scope:     claims.Scope,
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		Audience:  claims.Audience,
+		Issuer:    claims.Issuer,
+		TokenType: "Bearer",
+		SessionID: claims.SessionID,
+	}
+	if claims.ExpiresAt != nil {
+		resp.ExpiresAt = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.IssuedAt = claims.IssuedAt.Unix()
+	}
+	return resp, nil
+}
+
+// introspectRefreshToken returns nil if tok is not a refresh token. Refresh
+// tokens are only disclosed to the client they were issued to.
+func (h *OAuthHandler) introspectRefreshToken(c echo.Context, client *model.Client, tok string) (*model.IntrospectionResponse, error) {
+	rt, err := h.repo.RefreshTokens.GetByHash(c.Request().Context(), hashSecret(tok))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to find refresh token", "error", err)
+		return nil, err
+	}
+	if rt.RotatedAt != nil {
+		return &model.IntrospectionResponse{}, nil
+	}
+
+	session, err := h.repo.Sessions.GetByID(c.Request().Context(), rt.SessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return &model.IntrospectionResponse{}, nil
+		}
+		logger.Error("failed to fetch session", "error", err)
+		return nil, err
+	}
+
+	if !session.ClientID.Valid || session.ClientID.UUID != client.ID || time.Now().After(session.ExpiresAt) {
+		return &model.IntrospectionResponse{}, nil
+	}
+
+	return &model.IntrospectionResponse{
+		Active:    true,
+		Scope:     session.Scope,
+		ClientID:  session.ClientID.UUID.String(),
+		Subject:   session.UserID.String(),
+		Issuer:    h.tokens.Issuer(),
+		TokenType: tokenTypeHintRefreshToken,
+		ExpiresAt: session.ExpiresAt.Unix(),
+		IssuedAt:  rt.CreatedAt.Unix(),
+		SessionID: session.ID.String(),
+	}, nil
+}
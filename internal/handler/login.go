@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const loginPath = "/login"
+
+// Errors of checkCredentials that may be shown to the user.
+var (
+	errInvalidCredentials = errors.New("invalid email or password")
+	errAccountDisabled    = errors.New("account is disabled")
+)
+
+type loginPage struct {
+	Title    string
+	Error    string
+	CSRF     string
+	ReturnTo string
+	Email    string
+	// Name is set once the user is signed in.
+	Name string
+	// Reauthenticate shows the form to a signed-in user, who is asked to sign
+	// in again or to pick another account.
+	Reauthenticate bool
+	// Continue links to ReturnTo with the current account.
+	Continue string
+}
+
+// LoginPage godoc
+// @Summary Browser sign-in page
+// @Description Signs the user in to the SSO browser session. Already signed-in
+// @Description users are sent straight to return_to, unless prompt asks them to
+// @Description sign in again (login) or to confirm the account (select_account).
+// @Tags auth
+// @Produce html
+// @Param return_to query string false "Local path to continue to after signing in"
+// @Param login_hint query string false "Email to prefill"
+// @Param prompt query string false "login or select_account"
+// @Success 200
+// @Success 302 "Redirect to return_to when already signed in"
+// @Router /login [get]
+func (h *AuthHandler) LoginPage(c echo.Context) error {
+	page := &loginPage{
+		Title:    "Sign in",
+		CSRF:     middleware.CSRFToken(c),
+		ReturnTo: safeReturnTo(c.QueryParam("return_to")),
+		Email:    c.QueryParam("login_hint"),
+	}
+	prompt := c.QueryParam("prompt")
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return render(c, http.StatusOK, "login.html", page)
+	}
+	if prompt != promptLogin && prompt != promptSelectAccount && page.ReturnTo != "" {
+		return c.Redirect(http.StatusFound, page.ReturnTo)
+	}
+
+	user, err := h.repo.Users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("failed to fetch user", "error", err)
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "login.html", page)
+	}
+	page.Name = user.Name
+
+	switch prompt {
+	case promptLogin:
+		page.Reauthenticate = true
+		if page.Email == "" {
+			page.Email = user.Email
+		}
+	case promptSelectAccount:
+		page.Reauthenticate = true
+		page.Continue = page.ReturnTo
+	default:
+		page.Title = "Signed in"
+	}
+	return render(c, http.StatusOK, "login.html", page)
+}
+
+// LoginSubmit godoc
+// @Summary Submit the browser sign-in form
+// @Tags auth
+// @Accept application/x-www-form-urlencoded
+// @Produce html
+// @Param email formData string true "Email"
+// @Param password formData string true "Password"
+// @Param return_to formData string false "Local path to continue to after signing in"
+// @Success 303 "Redirect to return_to"
+// @Failure 401
+// @Router /login [post]
+func (h *AuthHandler) LoginSubmit(c echo.Context) error {
+	page := &loginPage{
+		Title:    "Sign in",
+		CSRF:     middleware.CSRFToken(c),
+		ReturnTo: safeReturnTo(c.FormValue("return_to")),
+		Email:    c.FormValue("email"),
+	}
+
+	user, err := h.checkCredentials(c, page.Email, c.FormValue("password"))
+	switch {
+	case err == nil:
+	case errors.Is(err, errInvalidCredentials):
+		page.Error = "Invalid email or password."
+		return render(c, http.StatusUnauthorized, "login.html", page)
+	case errors.Is(err, errAccountDisabled):
+		page.Error = "This account is disabled."
+		return render(c, http.StatusUnauthorized, "login.html", page)
+	default:
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "login.html", page)
+	}
+
+	session := &model.Session{
+		UserID:   user.ID,
+		AuthTime: time.Now().UTC(),
+		AMR:      []string{"pwd"},
+		ACR:      model.ACRPassword,
+	}
+	if err := h.sessions.Start(c, session); err != nil {
+		logger.Error("failed to start browser session", "error", err)
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "login.html", page)
+	}
+
+	logger.Info("user signed in", "user_id", user.ID, "session_id", session.ID)
+
+	if page.ReturnTo == "" {
+		page.ReturnTo = loginPath
+	}
+	return c.Redirect(http.StatusSeeOther, page.ReturnTo)
+}
+
+// checkCredentials returns the active user with the given email and password.
+// Errors other than errInvalidCredentials and errAccountDisabled have been
+// logged.
+func (h *AuthHandler) checkCredentials(c echo.Context, email, password string) (*model.User, error) {
+	user, err := h.repo.Users.GetByEmail(c.Request().Context(), strings.ToLower(strings.TrimSpace(email)))
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logger.Error("failed to find user", "error", err)
+		return nil, err
+	}
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, errInvalidCredentials
+	}
+	if !user.IsActive {
+		return nil, errAccountDisabled
+	}
+	return user, nil
+}
+
+// redirectToLogin sends the user to the login page, to continue at returnTo.
+// params are further query parameters for the page, such as login_hint.
+func redirectToLogin(c echo.Context, returnTo string, params url.Values) error {
+	q := url.Values{"return_to": {returnTo}}
+	for name, values := range params {
+		q[name] = values
+	}
+	return c.Redirect(http.StatusFound, loginPath+"?"+q.Encode())
+}
+
+// safeReturnTo returns s if it is a local path and "" otherwise, so the login
+// page cannot be turned into an open redirect.
+func safeReturnTo(s string) string {
+	if !strings.HasPrefix(s, "/") || strings.HasPrefix(s, "//") || strings.HasPrefix(s, "/\\") {
+		return ""
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return ""
+	}
+	return s
+}
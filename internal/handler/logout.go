@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/token"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// logoutRequest is a validated RP-initiated logout request.
+type logoutRequest struct {
+	// client is nil when the request does not identify one.
+	client *model.Client
+	// hint is nil without an id_token_hint.
+	hint *token.IDClaims
+	// redirectURI is empty when the user should stay on the signed-out page.
+	redirectURI string
+	state       string
+	// params are the request's original parameters, replayed by the
+	// confirmation form.
+	params url.Values
+}
+
+type logoutPage struct {
+	Title      string
+	Error      string
+	CSRF       string
+	ClientName string
+	Params     url.Values
+	// Done is set once the user has been signed out.
+	Done bool
+}
+
+// Logout godoc
+// @Summary OpenID Connect RP-initiated logout
+// @Description Ends the user's browser session and sends them back to the
+// @Description client. Without an id_token_hint for the signed-in user, the user
+// @Description is asked to confirm first.
+// @Tags oauth
+// @Produce html
+// @Param id_token_hint query string false "ID token previously issued to the client"
+// @Param client_id query string false "Client ID, when no id_token_hint is sent"
+// @Param post_logout_redirect_uri query string false "Registered URI to return to"
+// @Param state query string false "Opaque value returned to post_logout_redirect_uri"
+// @Success 200 "Confirmation or signed-out page"
+// @Success 302 "Redirect to post_logout_redirect_uri with state"
+// @Failure 400 {string} string "HTML error page when the request is invalid"
+// @Router /oauth/logout [get]
+func (h *OAuthHandler) Logout(c echo.Context) error {
+	req, err := h.parseLogoutRequest(c, c.QueryParams())
+	if req == nil {
+		return err
+	}
+
+	// Anyone can link to this endpoint, so only a hint naming the signed-in
+	// user lets the session end without asking.
+	if session, ok := middleware.BrowserSession(c); ok && (req.hint == nil || req.hint.Subject != session.UserID.String()) {
+		page := &logoutPage{
+			Title:  "Sign out",
+			CSRF:   middleware.CSRFToken(c),
+			Params: req.params,
+		}
+		if req.client != nil {
+			page.ClientName = req.client.Name
+		}
+		return render(c, http.StatusOK, "logout.html", page)
+	}
+
+	return h.endBrowserSession(c, req)
+}
+
+// LogoutConfirm godoc
+// @Summary Confirm signing out
+// @Tags oauth
+// @Accept application/x-www-form-urlencoded
+// @Produce html
+// @Success 200 "Signed-out page"
+// @Success 302 "Redirect to post_logout_redirect_uri with state"
+// @Failure 400 {string} string "HTML error page when the request is invalid"
+// @Router /oauth/logout [post]
+func (h *OAuthHandler) LogoutConfirm(c echo.Context) error {
+	form, err := c.FormParams()
+	if err != nil {
+		return renderError(c, http.StatusBadRequest, "The request could not be read.")
+	}
+
+	params := url.Values{}
+	for name, values := range form {
+		if name != "csrf" {
+			params[name] = values
+		}
+	}
+
+	req, err := h.parseLogoutRequest(c, params)
+	if req == nil {
+		return err
+	}
+
+	return h.endBrowserSession(c, req)
+}
+
+// parseLogoutRequest validates the parameters of a logout request. When it
+// returns a nil request the error page has been written and err should be
+// returned as is.
+func (h *OAuthHandler) parseLogoutRequest(c echo.Context, params url.Values) (*logoutRequest, error) {
+	req := &logoutRequest{
+		redirectURI: params.Get("post_logout_redirect_uri"),
+		state:       params.Get("state"),
+		params:      params,
+	}
+
+	clientID := params.Get("client_id")
+	if raw := params.Get("id_token_hint"); raw != "" {
+		hint, err := h.tokens.VerifyIDTokenHint(raw)
+		if err != nil {
+			logger.Warn("oauth logout rejected id_token_hint", "error", err)
+			return nil, renderError(c, http.StatusBadRequest, "The sign-out request is invalid.")
+		}
+		if clientID != "" && clientID != hint.AuthorizedParty {
+			return nil, renderError(c, http.StatusBadRequest, "The sign-out request is invalid.")
+		}
+		req.hint = hint
+		clientID = hint.AuthorizedParty
+	}
+
+	if clientID != "" {
+		client, err := h.findClient(c, clientID)
+		if err != nil {
+			return nil, renderError(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		}
+		req.client = client
+	}
+
+	// The redirect URI can only be trusted once it is registered for a known
+	// client; otherwise this would be an open redirect.
+	if req.redirectURI != "" {
+		if req.client == nil {
+			return nil, renderError(c, http.StatusBadRequest, "The application is unknown or disabled.")
+		}
+		if !matchRedirectURI(req.client.PostLogoutRedirectURIs, req.redirectURI) {
+			logger.Warn("oauth logout rejected unregistered post_logout_redirect_uri",
+				"client_id", req.client.ID, "post_logout_redirect_uri", req.redirectURI)
+			return nil, renderError(c, http.StatusBadRequest, "The redirect URI is not registered for this application.")
+		}
+	}
+
+	return req, nil
+}
+
+// endBrowserSession signs the user out and sends them back to the client, or
+// shows the signed-out page if the client did not ask for a redirect.
+func (h *OAuthHandler) endBrowserSession(c echo.Context, req *logoutRequest) error {
+	if session, ok := middleware.BrowserSession(c); ok {
+		if err := h.sessions.End(c); err != nil {
+			logger.Error("failed to end browser session", "error", err)
+			return renderError(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+		}
+		logger.Info("user signed out", "user_id", session.UserID, "session_id", session.ID)
+	}
+
+	if req.redirectURI == "" {
+		return render(c, http.StatusOK, "logout.html", &logoutPage{
+			Title: "Signed out",
+			Done:  true,
+		})
+	}
+	return redirectWithParams(c, req.redirectURI, url.Values{"state": {req.state}})
+}
@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/ali/sso-server/internal/middleware"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/totp"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+const mfaPath = "/login/mfa"
+
+const (
+	// totpMaxAttempts is how many codes may be tried before TOTP is locked.
+	totpMaxAttempts = 5
+	// totpLockout is how long TOTP stays locked after too many invalid codes.
+	totpLockout = 15 * time.Minute
+)
+
+var (
+	errInvalidTOTPCode = errors.New("invalid code")
+	errTOTPLocked      = errors.New("too many invalid codes, try again later")
+)
+
+type mfaPage struct {
+	Title    string
+	Error    string
+	CSRF     string
+	ReturnTo string
+}
+
+// MFAPage godoc
+// @Summary Two-factor step-up page
+// @Description Asks a signed-in user for a code from their authenticator app.
+// @Description Clients get here by sending acr_values=mfa to /oauth/authorize.
+// @Tags auth
+// @Produce html
+// @Param return_to query string false "Local path to continue to after verifying"
+// @Success 200
+// @Success 302 "Redirect to /login without a browser session"
+// @Router /login/mfa [get]
+func (h *AuthHandler) MFAPage(c echo.Context) error {
+	page := &mfaPage{
+		Title:    "Two-factor authentication",
+		CSRF:     middleware.CSRFToken(c),
+		ReturnTo: safeReturnTo(c.QueryParam("return_to")),
+	}
+
+	user, err := h.mfaUser(c, page)
+	if user == nil {
+		return err
+	}
+
+	return render(c, http.StatusOK, "mfa.html", page)
+}
+
+// MFASubmit godoc
+// @Summary Submit the two-factor step-up form
+// @Description Verifies the code and raises the browser session to acr=mfa.
+// @Tags auth
+// @Accept application/x-www-form-urlencoded
+// @Produce html
+// @Param code formData string true "Six-digit code"
+// @Param return_to formData string false "Local path to continue to after verifying"
+// @Success 303 "Redirect to return_to"
+// @Failure 401
+// @Router /login/mfa [post]
+func (h *AuthHandler) MFASubmit(c echo.Context) error {
+	page := &mfaPage{
+		Title:    "Two-factor authentication",
+		CSRF:     middleware.CSRFToken(c),
+		ReturnTo: safeReturnTo(c.FormValue("return_to")),
+	}
+
+	user, err := h.mfaUser(c, page)
+	if user == nil {
+		return err
+	}
+
+	switch err := checkTOTP(c.Request().Context(), h.repo, user, c.FormValue("code")); {
+	case err == nil:
+	case errors.Is(err, errInvalidTOTPCode):
+		page.Error = "Invalid code."
+		return render(c, http.StatusUnauthorized, "mfa.html", page)
+	case errors.Is(err, errTOTPLocked):
+		page.Error = "Too many invalid codes. Try again later."
+		return render(c, http.StatusTooManyRequests, "mfa.html", page)
+	default:
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "mfa.html", page)
+	}
+
+	now := time.Now().UTC()
+
+	session, _ := middleware.BrowserSession(c)
+	amr := slices.Clone(session.AMR)
+	for _, method := range []string{"otp", "mfa"} {
+		if !slices.Contains(amr, method) {
+			amr = append(amr, method)
+		}
+	}
+	if err := h.repo.Sessions.UpdateAuthContext(c.Request().Context(), session.ID, now, amr, model.ACRMFA); err != nil {
+		logger.Error("failed to update session", "error", err)
+		page.Error = "Something went wrong. Please try again."
+		return render(c, http.StatusInternalServerError, "mfa.html", page)
+	}
+
+	logger.Info("user verified second factor", "user_id", user.ID, "session_id", session.ID)
+
+	if page.ReturnTo == "" {
+		page.ReturnTo = loginPath
+	}
+	return c.Redirect(http.StatusSeeOther, page.ReturnTo)
+}
+
+// mfaUser returns the signed-in user if they have a second factor. When it
+// returns nil the response has been written and err should be returned as is.
+func (h *AuthHandler) mfaUser(c echo.Context, page *mfaPage) (*model.User, error) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return nil, redirectToLogin(c, mfaPath+"?return_to="+url.QueryEscape(page.ReturnTo), nil)
+	}
+
+	user, err := h.repo.Users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		logger.Error("failed to fetch user", "error", err)
+		return nil, renderError(c, http.StatusInternalServerError, "Something went wrong. Please try again.")
+	}
+	if !user.TOTPEnabled {
+		return nil, renderError(c, http.StatusBadRequest, "Two-factor authentication is not set up for your account.")
+	}
+	return user, nil
+}
+
+// checkTOTP verifies a code from the user's authenticator app. Each code is
+// accepted only once, and after totpMaxAttempts invalid codes in a row TOTP
+// is locked for totpLockout. Errors other than errInvalidTOTPCode and
+// errTOTPLocked have been logged.
+func checkTOTP(ctx context.Context, repo *repository.Repository, user *model.User, code string) error {
+	now := time.Now().UTC()
+
+	// The attempt is counted before the code is checked, so that concurrent
+	// guesses cannot get past the limit.
+	attempts, err := repo.Users.CountTOTPAttempt(ctx, user.ID, now)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return errTOTPLocked
+		}
+		logger.Error("failed to count totp attempt", "error", err)
+		return err
+	}
+
+	step, ok := totp.Validate(user.TOTPSecret, code, now)
+	if ok {
+		err := repo.Users.UseTOTPStep(ctx, user.ID, step)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to record totp step", "error", err)
+			return err
+		}
+		logger.Warn("rejected replayed totp code", "user_id", user.ID)
+	}
+
+	if attempts >= totpMaxAttempts {
+		if err := repo.Users.LockTOTP(ctx, user.ID, now.Add(totpLockout)); err != nil {
+			logger.Error("failed to lock totp", "error", err)
+			return err
+		}
+		logger.Warn("security event: too many invalid totp codes, locking",
+			"event", "totp_locked",
+			"user_id", user.ID,
+			"until", now.Add(totpLockout),
+		)
+		return errTOTPLocked
+	}
+	return errInvalidTOTPCode
+}
@@ -1,61 +1,69 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/middleware"
 	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/ali/sso-server/internal/token"
 	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
-type OAuthHandler struct {
-	// TODO: add oauth service
-}
-
-func NewOAuthHandler() *OAuthHandler {
-	return &OAuthHandler{}
-}
-
-// Authorize godoc
-// @Summary OAuth2 authorization endpoint
-// @Tags oauth
-// @Param client_id query string true "Client ID"
-// @Param redirect_uri query string true "Redirect URI"
-// @Param response_type query string true "Response type (code)"
-// @Param scope query string false "Requested scope"
-// @Param state query string true "State parameter"
-// @Success 302
-// @Failure 400 {object} ErrorResponse
-// @Router /oauth/authorize [get]
-func (h *OAuthHandler) Authorize(c echo.Context) error {
-	clientID := c.QueryParam("client_id")
-	redirectURI := c.QueryParam("redirect_uri")
-	responseType := c.QueryParam("response_type")
-	scope := c.QueryParam("scope")
-	state := c.QueryParam("state")
-
-	if clientID == "" || redirectURI == "" || responseType == "" || state == "" {
-		return badRequest(c, "missing required parameters")
+// clientAuthRealm is the realm of the challenge sent with invalid_client.
+const clientAuthRealm = "oauth"
+
+// Capabilities of the OAuth handlers, advertised in the discovery document.
+var (
+	supportedResponseTypes            = []string{"code"}
+	supportedGrantTypes               = []string{"authorization_code", "refresh_token", "client_credentials", grantTypeDeviceCode}
+	supportedTokenEndpointAuthMethods = []string{
+		model.AuthMethodClientSecretBasic,
+		model.AuthMethodClientSecretPost,
+		model.AuthMethodPrivateKeyJWT,
+		model.AuthMethodNone,
 	}
-
-	if responseType != "code" {
-		return badRequest(c, "unsupported response_type")
+	// Public clients cannot call the introspection endpoint.
+	introspectionAuthMethods = []string{
+		model.AuthMethodClientSecretBasic,
+		model.AuthMethodClientSecretPost,
+		model.AuthMethodPrivateKeyJWT,
 	}
+	supportedClaims = []string{
+		"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "amr", "acr",
+		"at_hash", "azp", "sid", "name", "updated_at", "email",
+	}
+)
 
-	// TODO: validate client_id
-	// TODO: validate redirect_uri
-	// TODO: check if user is logged in
-	// TODO: show consent page or redirect with code
-
-	logger.Info("oauth authorize request",
-		"client_id", clientID,
-		"redirect_uri", redirectURI,
-		"scope", scope,
-	)
+type OAuthHandler struct {
+	config   *config.Config
+	repo     *repository.Repository
+	tokens   *token.Service
+	auth     *middleware.Auth
+	sessions *middleware.Sessions
+	logouts  *backchannel.Notifier
+	scopes   *scope.Registry
+}
 
-	// Placeholder: redirect with authorization code
-	code := "authorization_code_placeholder"
-	return c.Redirect(http.StatusFound, redirectURI+"?code="+code+"&state="+state)
+func NewOAuthHandler(cfg *config.Config, repo *repository.Repository, tokens *token.Service, auth *middleware.Auth, sessions *middleware.Sessions, logouts *backchannel.Notifier, scopes *scope.Registry) *OAuthHandler {
+	return &OAuthHandler{
+		config:   cfg,
+		repo:     repo,
+		tokens:   tokens,
+		auth:     auth,
+		sessions: sessions,
+		logouts:  logouts,
+		scopes:   scopes,
+	}
 }
 
 // Token godoc
@@ -66,35 +74,43 @@ func (h *OAuthHandler) Authorize(c echo.Context) error {
 // @Param grant_type formData string true "Grant type"
 // @Param code formData string false "Authorization code"
 // @Param redirect_uri formData string false "Redirect URI"
-// @Param client_id formData string true "Client ID"
-// @Param client_secret formData string true "Client secret"
+// @Param client_id formData string false "Client ID (client_secret_post and none)"
+// @Param client_secret formData string false "Client secret (client_secret_post)"
+// @Param client_assertion_type formData string false "Client assertion type (private_key_jwt)"
+// @Param client_assertion formData string false "Signed client assertion (private_key_jwt)"
+// @Param code_verifier formData string false "PKCE code verifier"
 // @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Requested scope (client_credentials)"
+// @Param device_code formData string false "Device code (device_code grant)"
 // @Success 200 {object} model.TokenResponse
 // @Failure 400 {object} OAuthErrorResponse
 // @Failure 401 {object} OAuthErrorResponse
 // @Router /oauth/token [post]
 func (h *OAuthHandler) Token(c echo.Context) error {
+	noStore(c)
+
 	grantType := c.FormValue("grant_type")
-	clientID := c.FormValue("client_id")
-	clientSecret := c.FormValue("client_secret")
 
-	if clientID == "" || clientSecret == "" {
-		return oauthError(c, "invalid_client", "client credentials required")
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return clientAuthError(c, err)
 	}
 
-	// TODO: validate client credentials
-
 	switch grantType {
 	case "authorization_code":
-		return h.handleAuthorizationCode(c)
+		return h.handleAuthorizationCode(c, client)
 	case "refresh_token":
-		return h.handleRefreshToken(c)
+		return h.handleRefreshToken(c, client)
+	case "client_credentials":
+		return h.handleClientCredentials(c, client)
+	case grantTypeDeviceCode:
+		return h.handleDeviceCode(c, client)
 	default:
 		return oauthError(c, "unsupported_grant_type", "grant type not supported")
 	}
 }
 
-func (h *OAuthHandler) handleAuthorizationCode(c echo.Context) error {
+func (h *OAuthHandler) handleAuthorizationCode(c echo.Context, client *model.Client) error {
 	code := c.FormValue("code")
 	redirectURI := c.FormValue("redirect_uri")
 
@@ -102,38 +118,174 @@ func (h *OAuthHandler) handleAuthorizationCode(c echo.Context) error {
 		return oauthError(c, "invalid_request", "code and redirect_uri required")
 	}
 
-	// TODO: validate authorization code
-	// TODO: validate redirect_uri matches
-	// TODO: generate tokens
-	// TODO: delete authorization code
+	ctx := c.Request().Context()
+
+	authCode, err := h.repo.AuthCodes.Consume(ctx, code)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return oauthError(c, "invalid_grant", "invalid authorization code")
+		}
+		logger.Error("failed to consume authorization code", "error", err)
+		return internalError(c, "failed to exchange authorization code")
+	}
+	if authCode.ClientID != client.ID || authCode.RedirectURI != redirectURI {
+		return oauthError(c, "invalid_grant", "authorization code was not issued to this client")
+	}
+	if time.Now().After(authCode.ExpiresAt) {
+		return oauthError(c, "invalid_grant", "authorization code expired")
+	}
+
+	codeVerifier := c.FormValue("code_verifier")
+	if authCode.CodeChallenge != "" {
+		if !verifyCodeChallenge(codeVerifier, authCode.CodeChallenge, authCode.CodeChallengeMethod) {
+			return oauthError(c, "invalid_grant", "code_verifier does not match code_challenge")
+		}
+	} else if codeVerifier != "" {
+		return oauthError(c, "invalid_grant", "code_verifier sent but no code_challenge was used")
+	}
 
-	logger.Info("oauth token exchange", "grant_type", "authorization_code")
+	// The client's allowed scopes may have shrunk since the code was issued.
+	if err := h.scopes.Validate(strings.Fields(authCode.Scope), client.AllowedScopes); err != nil {
+		return oauthError(c, "invalid_scope", err.Error())
+	}
 
-	return c.JSON(http.StatusOK, model.TokenResponse{
-		AccessToken:  "access_token_placeholder",
-		RefreshToken: "refresh_token_placeholder",
-		TokenType:    "Bearer",
-		ExpiresIn:    3600,
-	})
+	active, err := h.parentSessionActive(c, authCode.SessionID, authCode.UserID)
+	if err != nil {
+		return internalError(c, "failed to exchange authorization code")
+	}
+	if !active {
+		return oauthError(c, "invalid_grant", "the user has signed out")
+	}
+
+	resp, err := h.startSession(c, client, &model.Session{
+		UserID:   authCode.UserID,
+		ParentID: authCode.SessionID,
+		Scope:    authCode.Scope,
+		AuthTime: authCode.AuthTime,
+		AMR:      authCode.AMR,
+		ACR:      authCode.ACR,
+	}, authCode.Nonce)
+	if err != nil {
+		return internalError(c, "failed to exchange authorization code")
+	}
+
+	logger.Info("oauth token exchange", "grant_type", "authorization_code", "client_id", client.ID)
+
+	return c.JSON(http.StatusOK, resp)
 }
 
-func (h *OAuthHandler) handleRefreshToken(c echo.Context) error {
+func (h *OAuthHandler) handleRefreshToken(c echo.Context, client *model.Client) error {
 	refreshToken := c.FormValue("refresh_token")
 
 	if refreshToken == "" {
 		return oauthError(c, "invalid_request", "refresh_token required")
 	}
 
-	// TODO: validate refresh token
-	// TODO: generate new tokens
+	rt, session, err := findRefreshToken(c, h.repo, h.logouts, refreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) || errors.Is(err, errRefreshTokenReused) {
+			return oauthError(c, "invalid_grant", "invalid refresh token")
+		}
+		return internalError(c, "failed to refresh token")
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return oauthError(c, "invalid_grant", "refresh token expired")
+	}
+	if session.ClientID.UUID != client.ID {
+		return oauthError(c, "invalid_grant", "refresh token was not issued to this client")
+	}
 
-	logger.Info("oauth token refresh", "grant_type", "refresh_token")
+	// A scope parameter narrows the new access token; the refresh token keeps
+	// the original grant (RFC 6749, section 6).
+	granted := *session
+	if requested := strings.Fields(c.FormValue("scope")); len(requested) > 0 {
+		for _, s := range requested {
+			if !token.HasScope(session.Scope, s) {
+				return oauthError(c, "invalid_scope", "scope exceeds the original grant: "+s)
+			}
+		}
+		granted.Scope = strings.Join(requested, " ")
+	}
+	if err := h.scopes.Validate(strings.Fields(granted.Scope), client.AllowedScopes); err != nil {
+		return oauthError(c, "invalid_scope", err.Error())
+	}
+
+	newRefreshToken, err := rotateRefreshToken(c, h.repo, h.logouts, rt, session)
+	if err != nil {
+		if errors.Is(err, errRefreshTokenReused) {
+			return oauthError(c, "invalid_grant", "invalid refresh token")
+		}
+		return internalError(c, "failed to refresh token")
+	}
+
+	accessToken, err := h.issueAccessToken(&granted, client)
+	if err != nil {
+		return internalError(c, "failed to refresh token")
+	}
+
+	// Refreshed ID tokens must not repeat the original nonce.
+	idToken, err := h.issueIDToken(c, &granted, client, "", accessToken)
+	if err != nil {
+		return internalError(c, "failed to refresh token")
+	}
+
+	logger.Info("oauth token refresh", "grant_type", "refresh_token", "client_id", client.ID)
 
 	return c.JSON(http.StatusOK, model.TokenResponse{
-		AccessToken:  "new_access_token_placeholder",
-		RefreshToken: "new_refresh_token_placeholder",
+		AccessToken:  accessToken,
+		RefreshToken: newRefreshToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    3600,
+		ExpiresIn:    int(h.tokens.AccessTokenExpiry().Seconds()),
+		IDToken:      idToken,
+		Scope:        granted.Scope,
+	})
+}
+
+// handleClientCredentials issues an access token to the client itself. No user
+// is involved, so there is no session, refresh token or ID token.
+func (h *OAuthHandler) handleClientCredentials(c echo.Context, client *model.Client) error {
+	if client.IsPublic() {
+		return oauthError(c, "unauthorized_client", "public clients cannot use the client_credentials grant")
+	}
+
+	// OIDC scopes describe a user, so only API scopes can be granted here.
+	var allowed []string
+	for _, name := range client.AllowedScopes {
+		if s, ok := h.scopes.Lookup(name); ok && !s.OIDC {
+			allowed = append(allowed, name)
+		}
+	}
+	if len(allowed) == 0 {
+		return oauthError(c, "unauthorized_client", "client is not allowed to use the client_credentials grant")
+	}
+
+	// Without a scope parameter the client receives every scope it is allowed.
+	scopes := strings.Fields(c.FormValue("scope"))
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	if err := h.scopes.Validate(scopes, allowed); err != nil {
+		return oauthError(c, "invalid_scope", err.Error())
+	}
+	scope := strings.Join(scopes, " ")
+
+	accessToken, _, err := h.tokens.IssueAccessToken(token.AccessTokenParams{
+		Subject:  client.ID.String(),
+		Scope:    scope,
+		ClientID: client.ID.String(),
+	})
+	if err != nil {
+		logger.Error("failed to issue access token", "error", err)
+		return internalError(c, "failed to issue token")
+	}
+
+	logger.Info("oauth token issued", "grant_type", "client_credentials", "client_id", client.ID, "scope", scope)
+
+	return c.JSON(http.StatusOK, model.TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(h.tokens.AccessTokenExpiry().Seconds()),
+		Scope:       scope,
 	})
 }
 
@@ -144,22 +296,95 @@ func (h *OAuthHandler) handleRefreshToken(c echo.Context) error {
 // @Param token formData string true "Token to revoke"
 // @Param token_type_hint formData string false "Token type hint (access_token or refresh_token)"
 // @Success 200
+// @Failure 400 {object} OAuthErrorResponse
+// @Failure 401 {object} OAuthErrorResponse
 // @Router /oauth/revoke [post]
 func (h *OAuthHandler) Revoke(c echo.Context) error {
-	token := c.FormValue("token")
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return clientAuthError(c, err)
+	}
+
+	tok := c.FormValue("token")
 	tokenTypeHint := c.FormValue("token_type_hint")
 
-	if token == "" {
+	if tok == "" {
 		return oauthError(c, "invalid_request", "token required")
 	}
 
-	// TODO: revoke token
+	// The hint only decides which lookup runs first (RFC 7009, section 2.1).
+	revokers := []func(echo.Context, *model.Client, string) (bool, error){
+		h.revokeAccessToken, h.revokeRefreshToken,
+	}
+	if tokenTypeHint == tokenTypeHintRefreshToken {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for _, revoke := range revokers {
+		found, err := revoke(c, client, tok)
+		if err != nil {
+			return internalError(c, "failed to revoke token")
+		}
+		if found {
+			break
+		}
+	}
 
-	logger.Info("oauth token revoked", "token_type_hint", tokenTypeHint)
+	logger.Info("oauth token revoked", "client_id", client.ID, "token_type_hint", tokenTypeHint)
 
+	// Unknown and already revoked tokens also get 200 (RFC 7009, section 2.2).
 	return c.NoContent(http.StatusOK)
 }
 
+// revokeAccessToken denylists the jti of an access token issued to the client
+// until the token expires. It reports false if tok is not such a token; a
+// non-nil error has been logged.
+func (h *OAuthHandler) revokeAccessToken(c echo.Context, client *model.Client, tok string) (bool, error) {
+	claims, err := h.tokens.VerifyAccessToken(tok)
+	if err != nil || claims.ID == "" || claims.ExpiresAt == nil {
+		return false, nil
+	}
+	if claims.ClientID != client.ID.String() {
+		logger.Warn("client tried to revoke another client's access token", "client_id", client.ID)
+		return true, nil
+	}
+
+	ctx := c.Request().Context()
+	if err := h.repo.RevokedTokens.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		logger.Error("failed to revoke access token", "error", err)
+		return false, err
+	}
+
+	// Entries are only needed until the token would have expired anyway.
+	if err := h.repo.RevokedTokens.DeleteExpired(ctx, time.Now().UTC()); err != nil {
+		logger.Error("failed to prune revoked tokens", "error", err)
+	}
+	return true, nil
+}
+
+// revokeRefreshToken ends the session the refresh token belongs to, which
+// revokes its whole token family and every access token issued from it. It reports false if tok
+// is not a refresh token; a non-nil error has been logged.
+func (h *OAuthHandler) revokeRefreshToken(c echo.Context, client *model.Client, tok string) (bool, error) {
+	ctx := c.Request().Context()
+
+	session, err := h.refreshTokenSession(c, tok)
+	if err != nil || session == nil {
+		return false, err
+	}
+	if session.ClientID.UUID != client.ID {
+		logger.Warn("client tried to revoke another client's refresh token", "client_id", client.ID)
+		return true, nil
+	}
+
+	// The client revoked its own session, so it is not notified.
+	if err := h.repo.Sessions.Delete(ctx, session.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		logger.Error("failed to delete session", "error", err)
+		return false, err
+	}
+	return true, nil
+}
+
 // UserInfo godoc
 // @Summary Get user info (OpenID Connect)
 // @Tags oauth
@@ -167,17 +392,41 @@ func (h *OAuthHandler) Revoke(c echo.Context) error {
 // @Produce json
 // @Success 200 {object} UserInfoResponse
 // @Failure 401 {object} OAuthErrorResponse
+// @Failure 403 {object} OAuthErrorResponse
 // @Router /oauth/userinfo [get]
 func (h *OAuthHandler) UserInfo(c echo.Context) error {
-	// TODO: get user from access token
+	p, ok := middleware.GetPrincipal(c)
+	if !ok || p.IsClient() {
+		return middleware.Challenge(c, http.StatusUnauthorized, "invalid_token", "the access token does not identify a user")
+	}
 
-	logger.Debug("oauth userinfo request")
+	// Tokens issued to clients need the openid scope and see the claims their
+	// scopes allow; first-party tokens carry the account scope instead and see
+	// every claim.
+	firstParty := p.HasScope(scope.Account)
+	if !firstParty && !p.HasScope("openid") {
+		return middleware.InsufficientScope(c, "openid")
+	}
 
-	return c.JSON(http.StatusOK, UserInfoResponse{
-		Sub:   "user_id_placeholder",
-		Email: "user@example.com",
-		Name:  "John Doe",
-	})
+	logger.Debug("oauth userinfo request", "user_id", p.UserID)
+
+	user, err := h.repo.Users.GetByID(c.Request().Context(), p.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return middleware.Challenge(c, http.StatusUnauthorized, "invalid_token", "unknown subject")
+		}
+		logger.Error("failed to fetch user", "error", err)
+		return internalError(c, "failed to fetch user info")
+	}
+
+	resp := UserInfoResponse{Sub: user.ID.String()}
+	if firstParty || p.HasScope("email") {
+		resp.Email = user.Email
+	}
+	if firstParty || p.HasScope("profile") {
+		resp.Name = user.Name
+	}
+	return c.JSON(http.StatusOK, resp)
 }
 
 type OAuthErrorResponse struct {
@@ -191,9 +440,199 @@ type UserInfoResponse struct {
 	Name  string `json:"name,omitempty"`
 }
 
+// authContext returns the authentication context of the current login
+// session, which ends up in ID tokens. Without a session it describes an
+// authentication happening now. A non-nil error has been logged.
+func (h *OAuthHandler) authContext(c echo.Context) (time.Time, []string, string, error) {
+	authTime, amr, acr := time.Now().UTC(), []string{}, ""
+
+	sessionID, ok := middleware.SessionID(c)
+	if !ok {
+		return authTime, amr, acr, nil
+	}
+
+	session, err := h.repo.Sessions.GetByID(c.Request().Context(), sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return authTime, amr, acr, nil
+		}
+		logger.Error("failed to fetch session", "error", err)
+		return time.Time{}, nil, "", err
+	}
+	return session.AuthTime, session.AMR, session.ACR, nil
+}
+
+// browserSessionID returns the browser session behind the request. Sessions
+// issued to clients are linked to it, so that signing out ends them too.
+func browserSessionID(c echo.Context) uuid.NullUUID {
+	session, ok := middleware.BrowserSession(c)
+	if !ok {
+		return uuid.NullUUID{}
+	}
+	return uuid.NullUUID{UUID: session.ID, Valid: true}
+}
+
+// parentSessionActive reports whether the browser session a code was issued
+// from still exists for the user. A session started from an ended one would
+// outlive the sign-out, and its client would never be told. A non-nil error
+// has been logged.
+func (h *OAuthHandler) parentSessionActive(c echo.Context, parentID uuid.NullUUID, userID uuid.UUID) (bool, error) {
+	if !parentID.Valid {
+		return true, nil
+	}
+
+	parent, err := h.repo.Sessions.GetByID(c.Request().Context(), parentID.UUID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		logger.Error("failed to fetch browser session", "error", err)
+		return false, err
+	}
+	return parent.UserID == userID && time.Now().Before(parent.ExpiresAt), nil
+}
+
+// startSession stores a new session for a user-approved grant to the client
+// and issues its tokens. The caller fills in the user, scope and
+// authentication context; errors have been logged.
+func (h *OAuthHandler) startSession(c echo.Context, client *model.Client, session *model.Session, nonce string) (*model.TokenResponse, error) {
+	now := time.Now().UTC()
+	session.ID = uuid.New()
+	session.ClientID = uuid.NullUUID{UUID: client.ID, Valid: true}
+	session.UserAgent = c.Request().UserAgent()
+	session.IPAddress = c.RealIP()
+	session.ExpiresAt = now.Add(h.tokens.RefreshTokenExpiry())
+	session.CreatedAt = now
+	if err := h.repo.Sessions.Create(c.Request().Context(), session); err != nil {
+		logger.Error("failed to create session", "error", err)
+		return nil, err
+	}
+
+	refreshToken, err := issueRefreshToken(c, h.repo, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := h.issueAccessToken(session, client)
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := h.issueIDToken(c, session, client, nonce, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(h.tokens.AccessTokenExpiry().Seconds()),
+		IDToken:      idToken,
+		Scope:        session.Scope,
+	}, nil
+}
+
+// issueAccessToken signs an access token for the session's user, audienced to the client.
+func (h *OAuthHandler) issueAccessToken(session *model.Session, client *model.Client) (string, error) {
+	accessToken, _, err := h.tokens.IssueAccessToken(token.AccessTokenParams{
+		Subject:   session.UserID.String(),
+		Audience:  []string{client.ID.String()},
+		Scope:     session.Scope,
+		SessionID: session.ID,
+		ClientID:  client.ID.String(),
+	})
+	if err != nil {
+		logger.Error("failed to issue access token", "error", err)
+		return "", err
+	}
+	return accessToken, nil
+}
+
+// issueIDToken returns an ID token when the session was granted the openid
+// scope, and an empty string otherwise.
+func (h *OAuthHandler) issueIDToken(c echo.Context, session *model.Session, client *model.Client, nonce, accessToken string) (string, error) {
+	if !token.HasScope(session.Scope, "openid") {
+		return "", nil
+	}
+
+	user, err := h.repo.Users.GetByID(c.Request().Context(), session.UserID)
+	if err != nil {
+		logger.Error("failed to fetch user", "error", err)
+		return "", err
+	}
+
+	idToken, err := h.tokens.IssueIDToken(token.IDTokenParams{
+		User:        user,
+		ClientID:    client.ID.String(),
+		Scope:       session.Scope,
+		Nonce:       nonce,
+		AuthTime:    session.AuthTime,
+		AMR:         session.AMR,
+		ACR:         session.ACR,
+		SessionID:   session.ID,
+		AccessToken: accessToken,
+	})
+	if err != nil {
+		logger.Error("failed to issue id token", "error", err)
+		return "", err
+	}
+	return idToken, nil
+}
+
+// findClient returns the active client with the given ID, or nil if there is none.
+// A non-nil error means the lookup itself failed and has been logged.
+func (h *OAuthHandler) findClient(c echo.Context, clientID string) (*model.Client, error) {
+	id, err := uuid.Parse(clientID)
+	if err != nil {
+		return nil, nil
+	}
+
+	client, err := h.repo.Clients.GetByID(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to fetch client", "error", err)
+		return nil, err
+	}
+	if !client.IsActive {
+		return nil, nil
+	}
+	return client, nil
+}
+
+// clientAuthError writes the response for a failed authenticateClient call.
+func clientAuthError(c echo.Context, err error) error {
+	var authErr *errClientAuth
+	if errors.As(err, &authErr) {
+		return oauthError(c, "invalid_client", authErr.description)
+	}
+	return internalError(c, "failed to authenticate client")
+}
+
+// oauthError writes an error response of the token-style endpoints (RFC 6749,
+// section 5.2). invalid_client is a 401 that advertises HTTP Basic, the
+// scheme clients may authenticate with; every other error is a 400.
 func oauthError(c echo.Context, err, description string) error {
-	return c.JSON(http.StatusBadRequest, OAuthErrorResponse{
+	status := http.StatusBadRequest
+	if err == "invalid_client" {
+		status = http.StatusUnauthorized
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Basic realm="`+clientAuthRealm+`"`)
+	}
+	return c.JSON(status, OAuthErrorResponse{
 		Error:       err,
 		Description: description,
 	})
 }
+
+// authorizeError sends an authorization error back to the client. It must
+// only be used once redirectURI has been matched against the client.
+func authorizeError(c echo.Context, redirectURI, state, err, description string) error {
+	logger.Debug("oauth authorize error", "error", err, "description", description)
+	return redirectWithParams(c, redirectURI, url.Values{
+		"error":             {err},
+		"error_description": {description},
+		"state":             {state},
+	})
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+
+	"github.com/ali/sso-server/internal/config"
+)
+
+// PKCE code challenge methods (RFC 7636).
+const (
+	pkceMethodS256  = "S256"
+	pkceMethodPlain = "plain"
+)
+
+// pkceValue matches code verifiers and challenges: 43-128 unreserved characters.
+var pkceValue = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+// codeChallengeMethods returns the PKCE methods accepted at the authorization endpoint.
+func codeChallengeMethods(cfg config.OAuthConfig) []string {
+	if cfg.AllowPlainPKCE {
+		return []string{pkceMethodS256, pkceMethodPlain}
+	}
+	return []string{pkceMethodS256}
+}
+
+// verifyCodeChallenge checks a code_verifier against the stored challenge.
+func verifyCodeChallenge(verifier, challenge, method string) bool {
+	if !pkceValue.MatchString(verifier) {
+		return false
+	}
+
+	var computed string
+	switch method {
+	case pkceMethodS256:
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case pkceMethodPlain:
+		computed = verifier
+	default:
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	// RFC 7636, appendix B.
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		method    string
+		want      bool
+	}{
+		{"S256", verifier, challenge, pkceMethodS256, true},
+		{"S256 mismatched verifier", strings.Repeat("a", 43), challenge, pkceMethodS256, false},
+		{"S256 verifier sent as challenge", challenge, challenge, pkceMethodS256, false},
+		{"plain", verifier, verifier, pkceMethodPlain, true},
+		{"plain mismatched verifier", verifier, strings.Repeat("a", 43), pkceMethodPlain, false},
+		{"plain challenge checked as S256", verifier, verifier, pkceMethodS256, false},
+		{"unknown method", verifier, verifier, "S512", false},
+		{"missing verifier", "", challenge, pkceMethodS256, false},
+		{"missing plain verifier", "", "", pkceMethodPlain, false},
+		{"verifier too short", strings.Repeat("a", 42), strings.Repeat("a", 42), pkceMethodPlain, false},
+		{"verifier too long", strings.Repeat("a", 129), strings.Repeat("a", 129), pkceMethodPlain, false},
+		{"shortest verifier", strings.Repeat("a", 43), strings.Repeat("a", 43), pkceMethodPlain, true},
+		{"longest verifier", strings.Repeat("a", 128), strings.Repeat("a", 128), pkceMethodPlain, true},
+		{"verifier with reserved characters", strings.Repeat("a", 42) + "+", strings.Repeat("a", 42) + "+", pkceMethodPlain, false},
+		{"verifier with space", strings.Repeat("a", 42) + " ", strings.Repeat("a", 42) + " ", pkceMethodPlain, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.verifier, tt.challenge, tt.method); got != tt.want {
+				t.Errorf("verifyCodeChallenge(%q, %q, %q) = %v, want %v", tt.verifier, tt.challenge, tt.method, got, tt.want)
+			}
+		})
+	}
+}
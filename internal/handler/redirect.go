@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/labstack/echo/v4"
+)
+
+// forbiddenRedirectSchemes run code or read local content when navigated to
+// instead of reaching the client.
+var forbiddenRedirectSchemes = []string{"javascript", "data", "vbscript", "file"}
+
+// validRedirectURI reports whether uri may be registered for a client: an
+// absolute URI without a fragment (RFC 6749, section 3.1.2).
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+	if slices.Contains(forbiddenRedirectSchemes, u.Scheme) {
+		return false
+	}
+	// Native apps may use private-use schemes (RFC 8252, section 7.1), which
+	// have no host.
+	return u.Hostname() != "" || (u.Scheme != "http" && u.Scheme != "https")
+}
+
+// validBackchannelLogoutURI reports whether the server can POST logout tokens
+// to uri (OpenID Connect Back-Channel Logout, section 2.2).
+func validBackchannelLogoutURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Fragment != "" || u.Host == "" {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// matchRedirectURI reports whether requested is one of the registered URIs.
+// Matching is exact, except that a registered loopback IP redirect accepts
+// any port, because native apps bind an ephemeral one (RFC 8252, section 7.3).
+func matchRedirectURI(registered []string, requested string) bool {
+	for _, uri := range registered {
+		if uri == requested {
+			return true
+		}
+	}
+
+	req, err := url.Parse(requested)
+	if err != nil || !isLoopback(req) {
+		return false
+	}
+	for _, uri := range registered {
+		reg, err := url.Parse(uri)
+		if err != nil || !isLoopback(reg) {
+			continue
+		}
+		if reg.Hostname() == req.Hostname() && reg.EscapedPath() == req.EscapedPath() &&
+			reg.RawQuery == req.RawQuery && reg.User == nil && req.User == nil && req.Fragment == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isLoopback reports whether u is an http URI on a loopback IP literal.
+// "localhost" is deliberately not included (RFC 8252, section 8.3).
+func isLoopback(u *url.URL) bool {
+	if u.Scheme != "http" {
+		return false
+	}
+	ip := net.ParseIP(u.Hostname())
+	return ip != nil && ip.IsLoopback()
+}
+
+// redirectWithParams redirects to the client's redirect URI with params added
+// to its query, keeping any query the URI was registered with.
+func redirectWithParams(c echo.Context, redirectURI string, params url.Values) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return internalError(c, "invalid redirect_uri")
+	}
+
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			if v != "" {
+				q.Add(k, v)
+			}
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return c.Redirect(http.StatusFound, u.String())
+}
@@ -0,0 +1,91 @@
+package handler
+
+import "testing"
+
+func TestValidRedirectURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want bool
+	}{
+		{"https://app.example/cb", true},
+		{"https://app.example/cb?tenant=1", true},
+		{"http://127.0.0.1/cb", true},
+		{"com.example.app:/oauth", true},
+		{"com.example.app://oauth", true},
+
+		{"", false},
+		{"/cb", false},
+		{"app.example/cb", false},
+		{"https://app.example/cb#frag", false},
+		{"https:///cb", false},
+		{"http://:8080/cb", false},
+		{"https:app.example/cb", false},
+
+		{"javascript:alert(1)", false},
+		{"javascript://app.example/%0aalert(1)", false},
+		{"JavaScript://app.example/", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"data://app.example/cb", false},
+		{"vbscript://app.example/cb", false},
+		{"file:///etc/passwd", false},
+		{"file://host/share", false},
+	}
+
+	for _, tt := range tests {
+		if got := validRedirectURI(tt.uri); got != tt.want {
+			t.Errorf("validRedirectURI(%q) = %v, want %v", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRedirectURI(t *testing.T) {
+	tests := []struct {
+		name       string
+		registered []string
+		requested  string
+		want       bool
+	}{
+		{"exact", []string{"https://app.example/cb"}, "https://app.example/cb", true},
+		{"one of several", []string{"https://a.example/cb", "https://app.example/cb"}, "https://app.example/cb", true},
+		{"registered query", []string{"https://app.example/cb?tenant=1"}, "https://app.example/cb?tenant=1", true},
+
+		{"path prefix", []string{"https://app.example/cb"}, "https://app.example/cb/evil", false},
+		{"shorter path", []string{"https://app.example/cb/inner"}, "https://app.example/cb", false},
+		{"trailing slash", []string{"https://app.example/cb"}, "https://app.example/cb/", false},
+		{"host suffix", []string{"https://app.example/cb"}, "https://app.example.evil/cb", false},
+		{"subdomain", []string{"https://app.example/cb"}, "https://evil.app.example/cb", false},
+		{"userinfo", []string{"https://app.example/cb"}, "https://app.example@evil.example/cb", false},
+		{"host case", []string{"https://app.example/cb"}, "https://APP.example/cb", false},
+		{"path case", []string{"https://app.example/cb"}, "https://app.example/CB", false},
+		{"scheme", []string{"https://app.example/cb"}, "http://app.example/cb", false},
+		{"port", []string{"https://app.example/cb"}, "https://app.example:8443/cb", false},
+		{"added query", []string{"https://app.example/cb"}, "https://app.example/cb?next=https://evil.example", false},
+		{"changed query", []string{"https://app.example/cb?tenant=1"}, "https://app.example/cb?tenant=2", false},
+		{"fragment", []string{"https://app.example/cb"}, "https://app.example/cb#frag", false},
+		{"encoded path", []string{"https://app.example/cb"}, "https://app.example/%63b", false},
+		{"nothing registered", nil, "https://app.example/cb", false},
+
+		{"loopback IPv4 any port", []string{"http://127.0.0.1/cb"}, "http://127.0.0.1:51234/cb", true},
+		{"loopback IPv4 registered port", []string{"http://127.0.0.1:8080/cb"}, "http://127.0.0.1:51234/cb", true},
+		{"loopback IPv6 any port", []string{"http://[::1]/cb"}, "http://[::1]:51234/cb", true},
+		{"loopback query kept", []string{"http://127.0.0.1/cb?x=1"}, "http://127.0.0.1:51234/cb?x=1", true},
+		{"loopback other path", []string{"http://127.0.0.1/cb"}, "http://127.0.0.1:51234/other", false},
+		{"loopback other query", []string{"http://127.0.0.1/cb"}, "http://127.0.0.1:51234/cb?x=1", false},
+		{"loopback other address", []string{"http://127.0.0.1/cb"}, "http://127.0.0.2:51234/cb", false},
+		{"loopback IPv4 for IPv6", []string{"http://[::1]/cb"}, "http://127.0.0.1:51234/cb", false},
+		{"loopback fragment", []string{"http://127.0.0.1/cb"}, "http://127.0.0.1:51234/cb#frag", false},
+		{"loopback userinfo", []string{"http://127.0.0.1/cb"}, "http://user@127.0.0.1:51234/cb", false},
+		{"loopback https", []string{"https://127.0.0.1/cb"}, "https://127.0.0.1:51234/cb", false},
+		{"localhost", []string{"http://localhost/cb"}, "http://localhost:51234/cb", false},
+		{"localhost for loopback", []string{"http://127.0.0.1/cb"}, "http://localhost:51234/cb", false},
+		{"non-loopback host", []string{"http://app.example/cb"}, "http://app.example:51234/cb", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchRedirectURI(tt.registered, tt.requested); got != tt.want {
+				t.Errorf("matchRedirectURI(%q, %q) = %v, want %v", tt.registered, tt.requested, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+// errRefreshTokenReused is returned when a refresh token that was already
+// rotated is presented again. The token's family has been revoked by then.
+var errRefreshTokenReused = errors.New("refresh token reused")
+
+// issueRefreshToken adds a new current refresh token to the session's family.
+// A non-nil error has been logged.
+func issueRefreshToken(c echo.Context, repo *repository.Repository, sessionID uuid.UUID) (string, error) {
+	refreshToken, err := randomToken(32)
+	if err != nil {
+		logger.Error("failed to generate refresh token", "error", err)
+		return "", err
+	}
+
+	if err := repo.RefreshTokens.Create(c.Request().Context(), &model.RefreshToken{
+		TokenHash: hashSecret(refreshToken),
+		SessionID: sessionID,
+		CreatedAt: time.Now().UTC(),
+	}); err != nil {
+		logger.Error("failed to store refresh token", "error", err)
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// findRefreshToken returns the refresh token and its session, or
+// repository.ErrNotFound if either is unknown. A rotated token yields
+// errRefreshTokenReused after its family has been revoked. Other errors have
+// been logged.
+func findRefreshToken(c echo.Context, repo *repository.Repository, logouts *backchannel.Notifier, refreshToken string) (*model.RefreshToken, *model.Session, error) {
+	ctx := c.Request().Context()
+
+	rt, err := repo.RefreshTokens.GetByHash(ctx, hashSecret(refreshToken))
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to find refresh token", "error", err)
+		}
+		return nil, nil, err
+	}
+
+	session, err := repo.Sessions.GetByID(ctx, rt.SessionID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to fetch session", "error", err)
+		}
+		return nil, nil, err
+	}
+
+	if rt.RotatedAt != nil {
+		revokeRefreshFamily(c, repo, logouts, session)
+		return nil, nil, errRefreshTokenReused
+	}
+	return rt, session, nil
+}
+
+// rotateRefreshToken retires rt and returns its replacement. Losing a race
+// against a concurrent rotation counts as reuse, because only one party can
+// legitimately hold the token.
+func rotateRefreshToken(c echo.Context, repo *repository.Repository, logouts *backchannel.Notifier, rt *model.RefreshToken, session *model.Session) (string, error) {
+	if err := repo.RefreshTokens.MarkRotated(c.Request().Context(), rt.TokenHash, time.Now().UTC()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			revokeRefreshFamily(c, repo, logouts, session)
+			return "", errRefreshTokenReused
+		}
+		logger.Error("failed to rotate refresh token", "error", err)
+		return "", err
+	}
+	return issueRefreshToken(c, repo, session.ID)
+}
+
+// revokeRefreshFamily ends the session after a rotated refresh token was
+// replayed. Whoever holds the family, legitimately or not, has to start over,
+// so the client is notified as well.
+func revokeRefreshFamily(c echo.Context, repo *repository.Repository, logouts *backchannel.Notifier, session *model.Session) {
+	logger.Warn("security event: refresh token reuse detected, revoking token family",
+		"event", "refresh_token_reuse",
+		"session_id", session.ID,
+		"user_id", session.UserID,
+		"client_id", session.ClientID.UUID,
+		"ip_address", c.RealIP(),
+		"user_agent", c.Request().UserAgent(),
+	)
+
+	ctx := c.Request().Context()
+	if err := repo.Sessions.Delete(ctx, session.ID); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			logger.Error("failed to revoke session", "session_id", session.ID, "error", err)
+		}
+		return
+	}
+	logouts.SessionsEnded(ctx, []model.Session{*session})
+}
+
+// refreshTokenSession returns the session a refresh token belongs to, whether
+// or not the token has been rotated, or nil if there is none. A non-nil error
+// has been logged.
+func (h *OAuthHandler) refreshTokenSession(c echo.Context, refreshToken string) (*model.Session, error) {
+	ctx := c.Request().Context()
+
+	rt, err := h.repo.RefreshTokens.GetByHash(ctx, hashSecret(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to find refresh token", "error", err)
+		return nil, err
+	}
+
+	session, err := h.repo.Sessions.GetByID(ctx, rt.SessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to fetch session", "error", err)
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/google/uuid"
+)
+
+type refreshFixture struct {
+	repo    *repository.Repository
+	logouts *backchannel.Notifier
+	client  *model.Client
+	session *model.Session
+}
+
+func setupRefresh(t *testing.T) *refreshFixture {
+	t.Helper()
+	ctx := context.Background()
+	repo := setup(t)
+
+	user := &model.User{
+		ID:        uuid.New(),
+		Email:     "user@sso.test",
+		Name:      "User",
+		IsActive:  true,
+		CreatedAt: time.Now().UTC(),
+		UpdatedAt: time.Now().UTC(),
+	}
+	if err := repo.Users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	client := createClient(t, repo, &model.Client{
+		AuthMethod:           model.AuthMethodClientSecretBasic,
+		BackchannelLogoutURI: "https://app.test/logout",
+	})
+
+	session := &model.Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scope:     "openid offline_access",
+		AuthTime:  time.Now().UTC(),
+		ExpiresAt: time.Now().UTC().Add(time.Hour),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := repo.Sessions.Create(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	return &refreshFixture{
+		repo:    repo,
+		logouts: backchannel.NewNotifier(config.BackchannelLogoutConfig{MaxAttempts: 1}, repo, nil),
+		client:  client,
+		session: session,
+	}
+}
+
+// refresh presents the refresh token and rotates it as the token endpoint does.
+func (f *refreshFixture) refresh(t *testing.T, refreshToken string) (string, error) {
+	t.Helper()
+	c := tokenContext()
+	rt, session, err := findRefreshToken(c, f.repo, f.logouts, refreshToken)
+	if err != nil {
+		return "", err
+	}
+	return rotateRefreshToken(c, f.repo, f.logouts, rt, session)
+}
+
+// assertFamilyRevoked checks that the session has ended, its logout has been
+// queued, and none of the tokens work any more.
+func (f *refreshFixture) assertFamilyRevoked(t *testing.T, tokens ...string) {
+	t.Helper()
+	ctx := context.Background()
+
+	if _, err := f.repo.Sessions.GetByID(ctx, f.session.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("session lookup: err = %v, want ErrNotFound", err)
+	}
+	deliveries, err := f.repo.LogoutDeliveries.ListByClientID(ctx, f.client.ID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].SessionID != f.session.ID {
+		t.Errorf("got %d logout deliveries, want 1 for the session", len(deliveries))
+	}
+	for i, refreshToken := range tokens {
+		if _, err := f.refresh(t, refreshToken); !errors.Is(err, repository.ErrNotFound) {
+			t.Errorf("token %d after revocation: err = %v, want ErrNotFound", i, err)
+		}
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	f := setupRefresh(t)
+
+	first, err := issueRefreshToken(tokenContext(), f.repo, f.session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.refresh(t, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	third, err := f.refresh(t, second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.refresh(t, first); !errors.Is(err, errRefreshTokenReused) {
+		t.Fatalf("reused token: err = %v, want errRefreshTokenReused", err)
+	}
+	f.assertFamilyRevoked(t, first, second, third)
+}
+
+func TestConcurrentRefreshRevokesFamily(t *testing.T) {
+	f := setupRefresh(t)
+	c := tokenContext()
+
+	first, err := issueRefreshToken(c, f.repo, f.session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both parties find the token current, but only one can rotate it.
+	rt, session, err := findRefreshToken(c, f.repo, f.logouts, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	winner, err := rotateRefreshToken(c, f.repo, f.logouts, rt, session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotateRefreshToken(c, f.repo, f.logouts, rt, session); !errors.Is(err, errRefreshTokenReused) {
+		t.Fatalf("losing rotation: err = %v, want errRefreshTokenReused", err)
+	}
+	f.assertFamilyRevoked(t, first, winner)
+}
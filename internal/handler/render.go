@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed templates/*.html
+var templateFiles embed.FS
+
+// templates holds the server-rendered pages. Each page is named after its
+// file and may use the blocks defined in layout.html.
+var templates = template.Must(template.ParseFS(templateFiles, "templates/*.html"))
+
+// render writes the named page. Pages show user-specific state, so they are
+// never cached, and they act on the user's session, so they may not be framed
+// by other sites (clickjacking).
+func render(c echo.Context, status int, name string, data any) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		logger.Error("failed to render page", "page", name, "error", err)
+		return c.String(http.StatusInternalServerError, "internal server error")
+	}
+
+	header := c.Response().Header()
+	header.Set("Cache-Control", "no-store")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("Content-Security-Policy", "frame-ancestors 'none'")
+	return c.HTMLBlob(status, buf.Bytes())
+}
+
+type errorPage struct {
+	Title string
+	Error string
+}
+
+// renderError shows an error page to the user. It is used where redirecting
+// back to the client is unsafe, e.g. when the redirect URI cannot be trusted.
+func renderError(c echo.Context, status int, message string) error {
+	return render(c, status, "error.html", errorPage{
+		Title: "Something went wrong",
+		Error: message,
+	})
+}
@@ -50,6 +50,13 @@ func conflict(c echo.Context, message string) error {
 	})
 }
 
+func tooManyRequests(c echo.Context, message string) error {
+	return c.JSON(http.StatusTooManyRequests, ErrorResponse{
+		Error:   "too_many_requests",
+		Message: message,
+	})
+}
+
 func internalError(c echo.Context, message string) error {
 	return c.JSON(http.StatusInternalServerError, ErrorResponse{
 		Error:   "internal_error",
@@ -62,3 +69,10 @@ func success(c echo.Context, message string) error {
 		Message: message,
 	})
 }
+
+// noStore marks a response that carries credentials as uncacheable
+// (RFC 6749, section 5.1).
+func noStore(c echo.Context) {
+	c.Response().Header().Set("Cache-Control", "no-store")
+	c.Response().Header().Set("Pragma", "no-cache")
+}
@@ -1,20 +1,35 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
+	"time"
 
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/middleware"
 	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/totp"
 	"github.com/ali/sso-server/pkg/logger"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type UserHandler struct {
-	// TODO: add user service
+	config  *config.Config
+	repo    *repository.Repository
+	logouts *backchannel.Notifier
 }
 
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+func NewUserHandler(cfg *config.Config, repo *repository.Repository, logouts *backchannel.Notifier) *UserHandler {
+	return &UserHandler{
+		config:  cfg,
+		repo:    repo,
+		logouts: logouts,
+	}
 }
 
 // GetMe godoc
@@ -26,15 +41,19 @@ func NewUserHandler() *UserHandler {
 // @Failure 401 {object} ErrorResponse
 // @Router /api/v1/users/me [get]
 func (h *UserHandler) GetMe(c echo.Context) error {
-	// TODO: get user ID from JWT context
-	// TODO: fetch user from database
+	user, err := h.currentUser(c)
+	if user == nil {
+		return err
+	}
 
-	logger.Debug("fetching current user")
+	logger.Debug("fetching current user", "user_id", user.ID)
 
 	return c.JSON(http.StatusOK, model.UserResponse{
-		ID:    uuid.New(),
-		Email: "user@example.com",
-		Name:  "John Doe",
+		ID:          user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		Roles:       user.Roles,
+		TOTPEnabled: user.TOTPEnabled,
 	})
 }
 
@@ -56,20 +75,30 @@ func (h *UserHandler) UpdateMe(c echo.Context) error {
 		return badRequest(c, "invalid request body")
 	}
 
-	// TODO: get user ID from JWT context
-	// TODO: update user in database
-
-	logger.Info("user updated")
+	user, err := h.currentUser(c)
+	if user == nil {
+		return err
+	}
 
-	name := "John Doe"
 	if req.Name != nil {
-		name = *req.Name
+		if *req.Name == "" {
+			return badRequest(c, "name must not be empty")
+		}
+		user.Name = *req.Name
+		user.UpdatedAt = time.Now().UTC()
+		if err := h.repo.Users.UpdateName(c.Request().Context(), user.ID, user.Name, user.UpdatedAt); err != nil {
+			logger.Error("failed to update user", "error", err)
+			return internalError(c, "failed to update user")
+		}
+		logger.Info("user updated", "user_id", user.ID)
 	}
 
 	return c.JSON(http.StatusOK, model.UserResponse{
-		ID:    uuid.New(),
-		Email: "user@example.com",
-		Name:  name,
+		ID:          user.ID,
+		Email:       user.Email,
+		Name:        user.Name,
+		Roles:       user.Roles,
+		TOTPEnabled: user.TOTPEnabled,
 	})
 }
 
@@ -91,17 +120,336 @@ func (h *UserHandler) ChangePassword(c echo.Context) error {
 		return badRequest(c, "invalid request body")
 	}
 
-	// TODO: validate old password
-	// TODO: hash new password
-	// TODO: update password in database
-	// TODO: invalidate all sessions except current
+	if len(req.NewPassword) < 8 {
+		return badRequest(c, "new password must be at least 8 characters")
+	}
+
+	user, err := h.currentUser(c)
+	if user == nil {
+		return err
+	}
 
-	logger.Info("password changed")
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.OldPassword)) != nil {
+		return unauthorized(c, "old password is incorrect")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Error("failed to hash password", "error", err)
+		return internalError(c, "failed to change password")
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.repo.Users.UpdatePassword(ctx, user.ID, string(hash), time.Now().UTC()); err != nil {
+		logger.Error("failed to update password", "error", err)
+		return internalError(c, "failed to change password")
+	}
+
+	// Sign out everywhere else; the session making the change stays valid.
+	var ended []model.Session
+	if sessionID, ok := middleware.SessionID(c); ok {
+		ended, err = h.repo.Sessions.DeleteByUserIDExcept(ctx, user.ID, sessionID)
+	} else {
+		ended, err = h.repo.Sessions.DeleteByUserID(ctx, user.ID)
+	}
+	if err != nil {
+		// The new password is set, but sessions opened with the old one would
+		// survive, so the caller has to know the change is incomplete.
+		logger.Error("failed to invalidate sessions", "user_id", user.ID, "error", err)
+		return internalError(c, "password changed, but failed to sign out other sessions")
+	}
+	h.logouts.SessionsEnded(ctx, ended)
+
+	logger.Info("password changed", "user_id", user.ID)
 
 	return success(c, "password changed successfully")
 }
 
+// EnrollTOTP godoc
+// @Summary Start enrolling an authenticator app
+// @Description Generates a TOTP secret for the user. It is only used once
+// @Description confirmed with a code; enrolling again replaces an unconfirmed one.
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} TOTPEnrollmentResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/users/me/totp [post]
+func (h *UserHandler) EnrollTOTP(c echo.Context) error {
+	user, err := h.currentUser(c)
+	if user == nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return conflict(c, "two-factor authentication is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		logger.Error("failed to generate totp secret", "error", err)
+		return internalError(c, "failed to enroll authenticator")
+	}
+
+	if err := h.repo.Users.EnrollTOTP(c.Request().Context(), user.ID, secret, time.Now().UTC()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return conflict(c, "two-factor authentication is already enabled")
+		}
+		logger.Error("failed to update user", "error", err)
+		return internalError(c, "failed to enroll authenticator")
+	}
+
+	return c.JSON(http.StatusOK, TOTPEnrollmentResponse{
+		Secret: secret,
+		URI:    totp.URI(h.totpIssuer(), user.Email, secret),
+	})
+}
+
+// ConfirmTOTP godoc
+// @Summary Confirm an authenticator app
+// @Description Enables two-factor authentication once the app produces a valid code.
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param request body TOTPCodeRequest true "Code from the authenticator app"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /api/v1/users/me/totp/confirm [post]
+func (h *UserHandler) ConfirmTOTP(c echo.Context) error {
+	var req TOTPCodeRequest
+	if err := c.Bind(&req); err != nil {
+		logger.Error("failed to bind totp confirm request", "error", err)
+		return badRequest(c, "invalid request body")
+	}
+
+	user, err := h.currentUser(c)
+	if user == nil {
+		return err
+	}
+	if user.TOTPEnabled {
+		return conflict(c, "two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return badRequest(c, "no authenticator enrollment in progress")
+	}
+
+	if err := checkTOTP(c.Request().Context(), h.repo, user, req.Code); err != nil {
+		return h.totpError(c, err, "failed to confirm authenticator")
+	}
+
+	// The code was checked against this secret, so a concurrent enrollment
+	// must not be confirmed with it.
+	if err := h.repo.Users.EnableTOTP(c.Request().Context(), user.ID, user.TOTPSecret, time.Now().UTC()); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return conflict(c, "the authenticator enrollment has changed")
+		}
+		logger.Error("failed to update user", "error", err)
+		return internalError(c, "failed to confirm authenticator")
+	}
+
+	logger.Info("two-factor authentication enabled", "user_id", user.ID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// DisableTOTP godoc
+// @Summary Remove the authenticator app
+// @Description Requires the account password or a current code, so that a
+// @Description stolen access token cannot remove the second factor.
+// @Tags users
+// @Security BearerAuth
+// @Accept json
+// @Param request body DisableTOTPRequest true "Password or code"
+// @Success 204
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} ErrorResponse
+// @Router /api/v1/users/me/totp [delete]
+func (h *UserHandler) DisableTOTP(c echo.Context) error {
+	var req DisableTOTPRequest
+	if err := c.Bind(&req); err != nil {
+		logger.Error("failed to bind totp disable request", "error", err)
+		return badRequest(c, "invalid request body")
+	}
+
+	user, err := h.currentUser(c)
+	if user == nil {
+		return err
+	}
+	if !user.TOTPEnabled && user.TOTPSecret == "" {
+		return notFound(c, "two-factor authentication is not enabled")
+	}
+
+	switch {
+	case req.Code != "":
+		if err := checkTOTP(c.Request().Context(), h.repo, user, req.Code); err != nil {
+			return h.totpError(c, err, "failed to disable two-factor authentication")
+		}
+	case req.Password != "":
+		if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)) != nil {
+			return unauthorized(c, "password is incorrect")
+		}
+	default:
+		return badRequest(c, "password or code is required")
+	}
+
+	if err := h.repo.Users.DisableTOTP(c.Request().Context(), user.ID, time.Now().UTC()); err != nil {
+		logger.Error("failed to update user", "error", err)
+		return internalError(c, "failed to disable two-factor authentication")
+	}
+
+	logger.Info("two-factor authentication disabled", "user_id", user.ID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// totpError writes the response for an error of checkTOTP.
+func (h *UserHandler) totpError(c echo.Context, err error, message string) error {
+	switch {
+	case errors.Is(err, errInvalidTOTPCode):
+		return badRequest(c, "invalid code")
+	case errors.Is(err, errTOTPLocked):
+		return tooManyRequests(c, err.Error())
+	default:
+		return internalError(c, message)
+	}
+}
+
+// totpIssuer names the server in authenticator apps: the issuer's host, or
+// the issuer itself if it is not a URL.
+func (h *UserHandler) totpIssuer() string {
+	if u, err := url.Parse(h.config.JWT.Issuer); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return h.config.JWT.Issuer
+}
+
+// ListGrants godoc
+// @Summary List the applications the current user has granted access
+// @Tags users
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} model.GrantResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /api/v1/users/me/grants [get]
+func (h *UserHandler) ListGrants(c echo.Context) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return unauthorized(c, "authentication required")
+	}
+
+	ctx := c.Request().Context()
+
+	grants, err := h.repo.Grants.ListByUserID(ctx, userID)
+	if err != nil {
+		logger.Error("failed to list grants", "error", err)
+		return internalError(c, "failed to list grants")
+	}
+
+	resp := make([]model.GrantResponse, 0, len(grants))
+	for _, grant := range grants {
+		client, err := h.repo.Clients.GetByID(ctx, grant.ClientID)
+		if err != nil {
+			logger.Error("failed to fetch client", "error", err)
+			return internalError(c, "failed to list grants")
+		}
+		resp = append(resp, model.GrantResponse{
+			ClientID:   grant.ClientID,
+			ClientName: client.Name,
+			Scopes:     grant.Scopes,
+			CreatedAt:  grant.CreatedAt,
+			UpdatedAt:  grant.UpdatedAt,
+		})
+	}
+
+	return c.JSON(http.StatusOK, resp)
+}
+
+// RevokeGrant godoc
+// @Summary Withdraw an application's access
+// @Description Forgets the user's consent and ends the application's sessions,
+// @Description which invalidates its refresh and access tokens.
+// @Tags users
+// @Security BearerAuth
+// @Param client_id path string true "Client ID"
+// @Success 204
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /api/v1/users/me/grants/{client_id} [delete]
+func (h *UserHandler) RevokeGrant(c echo.Context) error {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return unauthorized(c, "authentication required")
+	}
+
+	clientID, err := uuid.Parse(c.Param("client_id"))
+	if err != nil {
+		return notFound(c, "grant not found")
+	}
+
+	ctx := c.Request().Context()
+
+	if err := h.repo.Grants.Delete(ctx, userID, clientID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return notFound(c, "grant not found")
+		}
+		logger.Error("failed to delete grant", "error", err)
+		return internalError(c, "failed to revoke grant")
+	}
+
+	ended, err := h.repo.Sessions.DeleteByUserIDAndClientID(ctx, userID, clientID)
+	if err != nil {
+		logger.Error("failed to delete client sessions", "error", err)
+		return internalError(c, "failed to revoke grant")
+	}
+	h.logouts.SessionsEnded(ctx, ended)
+
+	logger.Info("grant revoked", "user_id", userID, "client_id", clientID)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// currentUser loads the authenticated user. When it returns a nil user the
+// error response has already been written and err should be returned as is.
+func (h *UserHandler) currentUser(c echo.Context) (*model.User, error) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		return nil, unauthorized(c, "authentication required")
+	}
+
+	user, err := h.repo.Users.GetByID(c.Request().Context(), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, unauthorized(c, "user not found")
+		}
+		logger.Error("failed to fetch user", "error", err)
+		return nil, internalError(c, "failed to fetch user")
+	}
+	return user, nil
+}
+
 type ChangePasswordRequest struct {
 	OldPassword string `json:"old_password" validate:"required"`
 	NewPassword string `json:"new_password" validate:"required,min=8"`
 }
+
+type TOTPEnrollmentResponse struct {
+	Secret string `json:"secret"`
+	// URI is the otpauth:// URI to show as a QR code.
+	URI string `json:"uri"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// DisableTOTPRequest proves the caller is the user: either field will do.
+type DisableTOTPRequest struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"`
+}
@@ -0,0 +1,136 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// jwksMaxAge bounds how long relying parties cache our key set. New keys
+	// are published for longer than this before they sign anything.
+	jwksMaxAge = int(keys.JWKSMaxAge / time.Second)
+
+	discoveryMaxAge = 3600
+)
+
+type WellKnownHandler struct {
+	config *config.Config
+	keys   *keys.Manager
+	scopes *scope.Registry
+}
+
+func NewWellKnownHandler(cfg *config.Config, keyManager *keys.Manager, scopes *scope.Registry) *WellKnownHandler {
+	return &WellKnownHandler{
+		config: cfg,
+		keys:   keyManager,
+		scopes: scopes,
+	}
+}
+
+// OpenIDConfiguration godoc
+// @Summary OpenID Connect discovery document
+// @Tags well-known
+// @Produce json
+// @Success 200 {object} DiscoveryResponse
+// @Router /.well-known/openid-configuration [get]
+func (h *WellKnownHandler) OpenIDConfiguration(c echo.Context) error {
+	baseURL := strings.TrimSuffix(h.config.JWT.Issuer, "/")
+
+	// Only advertise endpoints that are actually routed.
+	routes := make(map[string]bool)
+	for _, r := range c.Echo().Routes() {
+		routes[r.Method+" "+r.Path] = true
+	}
+	endpoint := func(method, path string) string {
+		if !routes[method+" "+path] {
+			return ""
+		}
+		return baseURL + path
+	}
+
+	var algs []string
+	for _, k := range h.keys.PublicKeys() {
+		if !slices.Contains(algs, k.Algorithm) {
+			algs = append(algs, k.Algorithm)
+		}
+	}
+
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", discoveryMaxAge))
+
+	return c.JSON(http.StatusOK, DiscoveryResponse{
+		Issuer:                            h.config.JWT.Issuer,
+		AuthorizationEndpoint:             endpoint(http.MethodGet, "/oauth/authorize"),
+		TokenEndpoint:                     endpoint(http.MethodPost, "/oauth/token"),
+		UserInfoEndpoint:                  endpoint(http.MethodGet, "/oauth/userinfo"),
+		RevocationEndpoint:                endpoint(http.MethodPost, "/oauth/revoke"),
+		IntrospectionEndpoint:             endpoint(http.MethodPost, "/oauth/introspect"),
+		DeviceAuthorizationEndpoint:       endpoint(http.MethodPost, "/oauth/device_authorization"),
+		EndSessionEndpoint:                endpoint(http.MethodGet, "/oauth/logout"),
+		JWKSURI:                           endpoint(http.MethodGet, "/.well-known/jwks.json"),
+		ScopesSupported:                   h.scopes.Names(),
+		ResponseTypesSupported:            supportedResponseTypes,
+		ResponseModesSupported:            []string{"query"},
+		GrantTypesSupported:               supportedGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		TokenEndpointAuthMethodsSupported: supportedTokenEndpointAuthMethods,
+		TokenEndpointAuthSigningAlgValues: []string{keys.RS256, keys.ES256, keys.EdDSA},
+		RevocationAuthMethodsSupported:    supportedTokenEndpointAuthMethods,
+		IntrospectionAuthMethodsSupported: introspectionAuthMethods,
+		CodeChallengeMethodsSupported:     codeChallengeMethods(h.config.OAuth),
+		ClaimsSupported:                   supportedClaims,
+		ACRValuesSupported:                model.ACRValues,
+		PromptValuesSupported:             supportedPromptValues,
+		BackchannelLogoutSupported:        true,
+		BackchannelLogoutSessionSupported: true,
+	})
+}
+
+// JWKS godoc
+// @Summary Public signing keys
+// @Tags well-known
+// @Produce json
+// @Success 200 {object} keys.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *WellKnownHandler) JWKS(c echo.Context) error {
+	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", jwksMaxAge))
+	return c.JSON(http.StatusOK, h.keys.JWKS())
+}
+
+// DiscoveryResponse is the OpenID Provider metadata document.
+type DiscoveryResponse struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint,omitempty"`
+	TokenEndpoint                     string   `json:"token_endpoint,omitempty"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint,omitempty"`
+	RevocationEndpoint                string   `json:"revocation_endpoint,omitempty"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint,omitempty"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint,omitempty"`
+	EndSessionEndpoint                string   `json:"end_session_endpoint,omitempty"`
+	JWKSURI                           string   `json:"jwks_uri,omitempty"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	ResponseModesSupported            []string `json:"response_modes_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValues []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	RevocationAuthMethodsSupported    []string `json:"revocation_endpoint_auth_methods_supported"`
+	IntrospectionAuthMethodsSupported []string `json:"introspection_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	ACRValuesSupported                []string `json:"acr_values_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	BackchannelLogoutSupported        bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported bool     `json:"backchannel_logout_session_supported"`
+}
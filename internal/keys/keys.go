@@ -0,0 +1,434 @@
+package keys
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+)
+
+// Supported JWS signing algorithms.
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+const (
+	// JWKSMaxAge bounds how long relying parties may cache the published key
+	// set.
+	JWKSMaxAge = 5 * time.Minute
+	// reloadInterval is how often Run reloads the keys from the store.
+	reloadInterval = time.Minute
+	// PublishDelay is how long a rotated-in key is published before it signs
+	// anything: every instance has reloaded it and every relying party has
+	// refetched the key set by then.
+	PublishDelay = JWKSMaxAge + reloadInterval
+	// minReloadInterval limits the reloads caused by tokens with unknown kids.
+	minReloadInterval = 10 * time.Second
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// Key is a signing key identified by its kid.
+type Key struct {
+	ID        string
+	Algorithm string
+	Signer    crypto.Signer
+	CreatedAt time.Time
+	// ActivatesAt is when the key starts signing; it is published before.
+	ActivatesAt time.Time
+	RetiredAt   *time.Time
+}
+
+func (k *Key) Public() crypto.PublicKey {
+	return k.Signer.Public()
+}
+
+type Config struct {
+	// Algorithm is used for newly generated keys.
+	Algorithm string
+	// KeyFile optionally points to a PEM private key to use as the active key.
+	KeyFile string
+	// RotationInterval is how long a key stays active; zero disables rotation.
+	RotationInterval time.Duration
+	// Retention is how long a retired key can still verify tokens. It must
+	// outlive the longest token lifetime.
+	Retention time.Duration
+}
+
+// Manager owns the signing keys. Exactly one key is active and signs new
+// tokens. A rotated-in key is published for PublishDelay before it becomes
+// active, and retired keys stay available for verification until their
+// retention window ends. Keys are persisted so that every instance shares
+// them.
+type Manager struct {
+	store repository.SigningKeyRepository
+	cfg   Config
+
+	mu       sync.RWMutex
+	active   *Key
+	keys     map[string]*Key
+	loadedAt time.Time
+	reloadMu sync.Mutex
+}
+
+// NewManager loads the stored keys and makes sure an active key exists,
+// importing it from cfg.KeyFile or generating one as needed.
+func NewManager(ctx context.Context, store repository.SigningKeyRepository, cfg Config) (*Manager, error) {
+	m := &Manager{
+		store: store,
+		cfg:   cfg,
+	}
+
+	if err := m.load(ctx); err != nil {
+		return nil, err
+	}
+
+	if cfg.KeyFile != "" {
+		if err := m.importFile(ctx, cfg.KeyFile); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	// Without an active key nothing could be signed, so the first key is
+	// used straight away. A key for a newly configured algorithm is rotated
+	// in like any other.
+	switch active, next := m.SigningKey(), m.nextKey(); {
+	case active == nil:
+		signer, err := generate(cfg.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.activate(ctx, signer, cfg.Algorithm); err != nil {
+			return nil, err
+		}
+	case active.Algorithm != cfg.Algorithm && (next == nil || next.Algorithm != cfg.Algorithm):
+		if err := m.Rotate(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// SigningKey returns the active key.
+func (m *Manager) SigningKey() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.active
+}
+
+// nextKey returns the newest published key that is not active yet.
+func (m *Manager) nextKey() *Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var next *Key
+	for _, k := range m.keys {
+		if k.RetiredAt == nil && k.ActivatesAt.After(m.loadedAt) && (next == nil || k.ActivatesAt.After(next.ActivatesAt)) {
+			next = k
+		}
+	}
+	return next
+}
+
+// VerificationKey returns the published, active or retained key with the
+// given kid. An unknown kid may belong to a key another instance has just
+// stored, so the store is reloaded once before the kid is rejected.
+func (m *Manager) VerificationKey(kid string) (*Key, error) {
+	if key, ok := m.lookup(kid); ok {
+		return key, nil
+	}
+
+	// Concurrent misses share one reload, and reloads are rate limited so that
+	// made-up kids cannot turn into a query each.
+	m.reloadMu.Lock()
+	defer m.reloadMu.Unlock()
+
+	if key, ok := m.lookup(kid); ok {
+		return key, nil
+	}
+	m.mu.RLock()
+	recent := time.Since(m.loadedAt) < minReloadInterval
+	m.mu.RUnlock()
+	if recent {
+		return nil, ErrKeyNotFound
+	}
+
+	if err := m.load(context.Background()); err != nil {
+		logger.Error("failed to reload signing keys", "error", err)
+		return nil, ErrKeyNotFound
+	}
+	if key, ok := m.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (m *Manager) lookup(kid string) (*Key, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key, ok := m.keys[kid]
+	return key, ok
+}
+
+// PublicKeys returns all keys usable for verification, newest first.
+func (m *Manager) PublicKeys() []*Key {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]*Key, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+	return keys
+}
+
+// Rotate generates a new key and publishes it. It replaces the active key
+// after PublishDelay.
+func (m *Manager) Rotate(ctx context.Context) error {
+	signer, err := generate(m.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	key, err := newSigningKey(signer, m.cfg.Algorithm)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	key.CreatedAt = now
+	key.ActivatesAt = now.Add(PublishDelay)
+
+	if err := m.store.Create(ctx, key); err != nil {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+	if err := m.load(ctx); err != nil {
+		return err
+	}
+
+	logger.Info("signing key published", "kid", key.ID, "alg", key.Algorithm, "activates_at", key.ActivatesAt)
+	return nil
+}
+
+// Run rotates and prunes keys on schedule until ctx is cancelled. It also
+// reloads the store so that rotations made by other instances are picked up.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.tick(ctx); err != nil {
+				logger.Error("signing key maintenance failed", "error", err)
+			}
+		}
+	}
+}
+
+func (m *Manager) tick(ctx context.Context) error {
+	if err := m.load(ctx); err != nil {
+		return err
+	}
+
+	if err := m.retireReplaced(ctx); err != nil {
+		return err
+	}
+
+	if m.cfg.RotationInterval > 0 && m.cfg.KeyFile == "" && m.nextKey() == nil {
+		if active := m.SigningKey(); active == nil || time.Since(active.ActivatesAt) >= m.cfg.RotationInterval {
+			if err := m.Rotate(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return m.prune(ctx)
+}
+
+// retireReplaced retires the keys the active key has taken over from once a
+// published key has become active, which starts their retention window.
+func (m *Manager) retireReplaced(ctx context.Context) error {
+	active := m.SigningKey()
+	if active == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	replaced := false
+	for _, k := range m.keys {
+		if k != active && k.RetiredAt == nil && !k.ActivatesAt.After(m.loadedAt) {
+			replaced = true
+		}
+	}
+	m.mu.RUnlock()
+	if !replaced {
+		return nil
+	}
+
+	if err := m.store.Activate(ctx, active.ID, active.ActivatesAt); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("failed to retire signing keys: %w", err)
+	}
+	logger.Info("signing key activated", "kid", active.ID, "alg", active.Algorithm)
+	return m.load(ctx)
+}
+
+// prune deletes retired keys whose retention window has passed.
+func (m *Manager) prune(ctx context.Context) error {
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sk := range stored {
+		if sk.RetiredAt == nil || time.Since(*sk.RetiredAt) < m.cfg.Retention {
+			continue
+		}
+		if err := m.store.Delete(ctx, sk.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		logger.Info("signing key deleted", "kid", sk.ID)
+	}
+
+	return m.load(ctx)
+}
+
+// importFile makes the key in path the active key, storing it if it is new.
+func (m *Manager) importFile(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key file: %w", err)
+	}
+
+	signer, err := decodePrivateKey(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse signing key file: %w", err)
+	}
+
+	alg, err := algorithmFor(signer)
+	if err != nil {
+		return err
+	}
+	if alg != m.cfg.Algorithm {
+		return fmt.Errorf("signing key file holds an %s key but the configured algorithm is %s", alg, m.cfg.Algorithm)
+	}
+
+	kid, err := thumbprint(signer.Public())
+	if err != nil {
+		return err
+	}
+	if active := m.SigningKey(); active != nil && active.ID == kid {
+		return nil
+	}
+
+	return m.activate(ctx, signer, alg)
+}
+
+// activate makes signer the active key straight away and retires all others.
+// The key may already be stored, e.g. retired by an earlier rotation or
+// imported by another instance booting with the same key file.
+func (m *Manager) activate(ctx context.Context, signer crypto.Signer, alg string) error {
+	key, err := newSigningKey(signer, alg)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	key.CreatedAt = now
+	key.ActivatesAt = now
+
+	if err := m.store.Create(ctx, key); err != nil && !errors.Is(err, repository.ErrConflict) {
+		return fmt.Errorf("failed to store signing key: %w", err)
+	}
+
+	// Every other unretired key is retired, not only the one this instance
+	// has loaded, so that keys activated concurrently by other instances do
+	// not stay active alongside it.
+	if err := m.store.Activate(ctx, key.ID, now); err != nil {
+		return fmt.Errorf("failed to activate signing key: %w", err)
+	}
+
+	return m.load(ctx)
+}
+
+// newSigningKey encodes signer for storage, identified by its thumbprint.
+func newSigningKey(signer crypto.Signer, alg string) (*model.SigningKey, error) {
+	kid, err := thumbprint(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := encodePrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.SigningKey{
+		ID:         kid,
+		Algorithm:  alg,
+		PrivateKey: encoded,
+	}, nil
+}
+
+// load replaces the in-memory key set with the stored keys that are still
+// usable. The active key is the newest unretired key whose activation time has
+// come.
+func (m *Manager) load(ctx context.Context) error {
+	now := time.Now()
+	stored, err := m.store.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	var active *Key
+	keys := make(map[string]*Key, len(stored))
+	for _, sk := range stored {
+		if sk.RetiredAt != nil && time.Since(*sk.RetiredAt) >= m.cfg.Retention {
+			continue
+		}
+
+		signer, err := decodePrivateKey(sk.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("failed to decode signing key %s: %w", sk.ID, err)
+		}
+
+		key := &Key{
+			ID:          sk.ID,
+			Algorithm:   sk.Algorithm,
+			Signer:      signer,
+			CreatedAt:   sk.CreatedAt,
+			ActivatesAt: sk.ActivatesAt,
+			RetiredAt:   sk.RetiredAt,
+		}
+		keys[key.ID] = key
+
+		// Several instances may rotate concurrently; the newest key wins.
+		if key.RetiredAt == nil && !key.ActivatesAt.After(now) && (active == nil || key.ActivatesAt.After(active.ActivatesAt)) {
+			active = key
+		}
+	}
+
+	m.mu.Lock()
+	m.active = active
+	m.keys = keys
+	m.loadedAt = now
+	m.mu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package keys
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/database"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+)
+
+func setup(t *testing.T) (*sql.DB, *repository.Repository) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := logger.Init(logger.Config{Level: "error"}); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := database.Open(config.DatabaseConfig{Driver: database.DriverSQLite, DSN: t.TempDir() + "/sso.db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := database.NewMigrator(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, err := repository.New(db, database.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, repo
+}
+
+func newManager(t *testing.T, repo *repository.Repository, cfg Config) *Manager {
+	t.Helper()
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = ES256
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = time.Hour
+	}
+	m, err := NewManager(context.Background(), repo.SigningKeys, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// activateNow brings the activation of every published key forward to now,
+// as if PublishDelay had passed.
+func activateNow(t *testing.T, db *sql.DB) {
+	t.Helper()
+	now := time.Now().UTC()
+	if _, err := db.Exec(`UPDATE signing_keys SET activates_at = ? WHERE activates_at > ?`, now, now); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func unretired(t *testing.T, repo *repository.Repository) []string {
+	t.Helper()
+	stored, err := repo.SigningKeys.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, k := range stored {
+		if k.RetiredAt == nil {
+			ids = append(ids, k.ID)
+		}
+	}
+	return ids
+}
+
+func TestRotatePublishesBeforeSigning(t *testing.T) {
+	db, repo := setup(t)
+	ctx := context.Background()
+	m := newManager(t, repo, Config{})
+	other := newManager(t, repo, Config{})
+	current := m.SigningKey()
+
+	if err := m.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	next := m.nextKey()
+	if next == nil {
+		t.Fatal("rotated key is not published")
+	}
+	if m.SigningKey().ID != current.ID {
+		t.Fatal("rotated key signs before PublishDelay has passed")
+	}
+	if got := next.ActivatesAt.Sub(next.CreatedAt); got != PublishDelay {
+		t.Errorf("key activates %s after it is published, want %s", got, PublishDelay)
+	}
+
+	found := false
+	for _, k := range m.PublicKeys() {
+		found = found || k.ID == next.ID
+	}
+	if !found {
+		t.Error("published key is missing from the key set")
+	}
+
+	// Another instance that loaded its keys before the rotation finds the new
+	// key once its reload interval allows.
+	other.loadedAt = time.Now().Add(-minReloadInterval)
+	if _, err := other.VerificationKey(next.ID); err != nil {
+		t.Errorf("other instance rejects the published key: %v", err)
+	}
+
+	activateNow(t, db)
+	if err := m.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.SigningKey().ID != next.ID {
+		t.Fatal("published key did not become active")
+	}
+	if ids := unretired(t, repo); len(ids) != 1 || ids[0] != next.ID {
+		t.Errorf("unretired keys = %v, want only %s", ids, next.ID)
+	}
+	if _, err := m.VerificationKey(current.ID); err != nil {
+		t.Errorf("replaced key no longer verifies: %v", err)
+	}
+}
+
+func TestVerificationKeyRejectsUnknownKid(t *testing.T) {
+	_, repo := setup(t)
+	m := newManager(t, repo, Config{})
+	m.loadedAt = time.Now().Add(-minReloadInterval)
+
+	if _, err := m.VerificationKey("unknown"); err != ErrKeyNotFound {
+		t.Fatalf("err = %v, want ErrKeyNotFound", err)
+	}
+	// The miss reloaded the store, so another one right away does not.
+	if time.Since(m.loadedAt) >= minReloadInterval {
+		t.Error("unknown kid did not reload the keys")
+	}
+}
+
+func TestImportRetiredKeyFile(t *testing.T) {
+	db, repo := setup(t)
+	ctx := context.Background()
+
+	signer, err := generate(ES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pem, err := encodePrivateKey(signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/key.pem"
+	if err := os.WriteFile(path, pem, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	imported := newManager(t, repo, Config{KeyFile: path}).SigningKey()
+
+	// A rotation retires the imported key.
+	m := newManager(t, repo, Config{})
+	if err := m.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	activateNow(t, db)
+	if err := m.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if m.SigningKey().ID == imported.ID {
+		t.Fatal("imported key was not replaced")
+	}
+
+	// Booting with the key file again reactivates the stored key.
+	again := newManager(t, repo, Config{KeyFile: path})
+	if again.SigningKey().ID != imported.ID {
+		t.Fatalf("active key = %s, want the imported %s", again.SigningKey().ID, imported.ID)
+	}
+	if ids := unretired(t, repo); len(ids) != 1 || ids[0] != imported.ID {
+		t.Errorf("unretired keys = %v, want only %s", ids, imported.ID)
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/token"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	ErrTokenRevoked = errors.New("token has been revoked")
+	ErrSessionEnded = errors.New("session has ended")
+	ErrUserInactive = errors.New("user is inactive")
+)
+
+// Auth authenticates requests carrying a bearer access token (RFC 6750).
+type Auth struct {
+	tokens *token.Service
+	repo   *repository.Repository
+}
+
+func NewAuth(tokens *token.Service, repo *repository.Repository) *Auth {
+	return &Auth{
+		tokens: tokens,
+		repo:   repo,
+	}
+}
+
+// Verify validates an access token and returns its principal. Besides the
+// errors of token.Service.VerifyAccessToken it returns ErrTokenRevoked for a
+// denylisted token, ErrSessionEnded when the token's session is gone and
+// ErrUserInactive when its user has been deactivated or deleted; any other
+// error is an internal failure.
+func (a *Auth) Verify(ctx context.Context, raw string) (*Principal, error) {
+	claims, err := a.tokens.VerifyAccessToken(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := principalFromClaims(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", token.ErrInvalidToken, err)
+	}
+
+	revoked, err := a.repo.RevokedTokens.IsRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	if p.SessionID != uuid.Nil {
+		session, err := a.repo.Sessions.GetByID(ctx, p.SessionID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrSessionEnded
+			}
+			return nil, fmt.Errorf("failed to fetch session: %w", err)
+		}
+		if time.Now().After(session.ExpiresAt) {
+			return nil, ErrSessionEnded
+		}
+	}
+
+	if !p.IsClient() {
+		user, err := a.repo.Users.GetByID(ctx, p.UserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrUserInactive
+			}
+			return nil, fmt.Errorf("failed to fetch user: %w", err)
+		}
+		if !user.IsActive {
+			return nil, ErrUserInactive
+		}
+	}
+
+	return p, nil
+}
+
+// Required rejects requests without a valid bearer token and stores the
+// principal of valid ones in the context.
+func (a *Auth) Required() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			raw, err := bearerToken(c.Request())
+			if err != nil {
+				return Challenge(c, http.StatusBadRequest, "invalid_request", err.Error())
+			}
+			if raw == "" {
+				// No credentials at all: the challenge carries no error code.
+				return Challenge(c, http.StatusUnauthorized, "", "")
+			}
+
+			p, err := a.Verify(c.Request().Context(), raw)
+			switch {
+			case err == nil:
+			case errors.Is(err, token.ErrExpiredToken):
+				return Challenge(c, http.StatusUnauthorized, "invalid_token", "the access token expired")
+			case errors.Is(err, ErrTokenRevoked):
+				return Challenge(c, http.StatusUnauthorized, "invalid_token", "the access token has been revoked")
+			case errors.Is(err, ErrSessionEnded):
+				return Challenge(c, http.StatusUnauthorized, "invalid_token", "the session has ended")
+			case errors.Is(err, ErrUserInactive):
+				return Challenge(c, http.StatusUnauthorized, "invalid_token", "the user is inactive")
+			case errors.Is(err, token.ErrInvalidToken):
+				return Challenge(c, http.StatusUnauthorized, "invalid_token", "the access token is invalid")
+			default:
+				logger.Error("failed to authenticate request", "error", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error":   "internal_error",
+					"message": "failed to authenticate request",
+				})
+			}
+
+			SetPrincipal(c, p)
+			return next(c)
+		}
+	}
+}
+
+// RequireScope rejects principals that were not granted every given scope.
+// It must run after Required.
+func RequireScope(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p, ok := GetPrincipal(c)
+			if !ok {
+				return Challenge(c, http.StatusUnauthorized, "", "")
+			}
+			for _, scope := range scopes {
+				if !p.HasScope(scope) {
+					return InsufficientScope(c, strings.Join(scopes, " "))
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// Challenge writes an RFC 6750 error with its WWW-Authenticate header. An
+// empty code produces a bare challenge for requests without credentials.
+func Challenge(c echo.Context, status int, code, description string) error {
+	return challenge(c, status, code, description, "")
+}
+
+// InsufficientScope writes the 403 response for a token lacking scope.
+func InsufficientScope(c echo.Context, scope string) error {
+	return challenge(c, http.StatusForbidden, "insufficient_scope", "the access token lacks the required scope", scope)
+}
+
+func challenge(c echo.Context, status int, code, description, scope string) error {
+	params := []string{}
+	if code != "" {
+		params = append(params, fmt.Sprintf("error=%q", code))
+	}
+	if description != "" {
+		params = append(params, fmt.Sprintf("error_description=%q", description))
+	}
+	if scope != "" {
+		params = append(params, fmt.Sprintf("scope=%q", scope))
+	}
+
+	header := "Bearer"
+	if len(params) > 0 {
+		header += " " + strings.Join(params, ", ")
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, header)
+
+	if code == "" {
+		return c.NoContent(status)
+	}
+	return c.JSON(status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// bearerToken extracts the token from the Authorization header. It returns
+// an empty string when the header is absent and an error when it is malformed.
+func bearerToken(r *http.Request) (string, error) {
+	header := r.Header.Get(echo.HeaderAuthorization)
+	if header == "" {
+		return "", nil
+	}
+
+	scheme, raw, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", errors.New("authorization header must use the Bearer scheme")
+	}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("bearer token is empty")
+	}
+	return raw, nil
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/ali/sso-server/internal/token"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const principalKey = "principal"
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	// UserID is uuid.Nil when a client acts on its own behalf
+	// (client_credentials).
+	UserID uuid.UUID
+	// ClientID is uuid.Nil for first-party tokens from /api/v1/auth/login.
+	ClientID  uuid.UUID
+	SessionID uuid.UUID
+	Scopes    []string
+	// Claims is nil when the principal comes from a browser session.
+	Claims *token.Claims
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// IsClient reports whether the principal is a client rather than a user.
+func (p *Principal) IsClient() bool {
+	return p.UserID == uuid.Nil
+}
+
+func SetPrincipal(c echo.Context, p *Principal) {
+	c.Set(principalKey, p)
+}
+
+// GetPrincipal returns the principal stored by the auth middleware, if any.
+func GetPrincipal(c echo.Context) (*Principal, bool) {
+	p, ok := c.Get(principalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// UserID returns the authenticated user's ID. It reports false when the
+// request is unauthenticated or made by a client on its own behalf.
+func UserID(c echo.Context) (uuid.UUID, bool) {
+	p, ok := GetPrincipal(c)
+	if !ok || p.IsClient() {
+		return uuid.Nil, false
+	}
+	return p.UserID, true
+}
+
+// SessionID returns the ID of the session behind the request, if any.
+func SessionID(c echo.Context) (uuid.UUID, bool) {
+	p, ok := GetPrincipal(c)
+	if !ok || p.SessionID == uuid.Nil {
+		return uuid.Nil, false
+	}
+	return p.SessionID, true
+}
+
+func principalFromClaims(claims *token.Claims) (*Principal, error) {
+	p := &Principal{
+		Scopes: strings.Fields(claims.Scope),
+		Claims: claims,
+	}
+
+	var err error
+	if claims.ClientID != "" {
+		if p.ClientID, err = uuid.Parse(claims.ClientID); err != nil {
+			return nil, errors.New("malformed client_id")
+		}
+	}
+	if claims.SessionID != "" {
+		if p.SessionID, err = uuid.Parse(claims.SessionID); err != nil {
+			return nil, errors.New("malformed sid")
+		}
+	}
+
+	// Client credentials tokens name the client as their subject.
+	if p.ClientID != uuid.Nil && p.SessionID == uuid.Nil && claims.Subject == claims.ClientID {
+		return p, nil
+	}
+	if p.UserID, err = uuid.Parse(claims.Subject); err != nil {
+		return nil, errors.New("malformed sub")
+	}
+	return p, nil
+}
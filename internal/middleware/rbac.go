@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/labstack/echo/v4"
+)
+
+// RequirePermission rejects requests whose user does not hold p through one
+// of their roles. Roles are loaded on every request so that revoking one
+// takes effect immediately. It must run after Required. It only looks at the
+// user, so routes that must not be reachable with a token issued to a client
+// also need RequireScope(scope.Account).
+func (a *Auth) RequirePermission(p model.Permission) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, ok := UserID(c)
+			if !ok {
+				return forbidden(c)
+			}
+
+			user, err := a.repo.Users.GetByID(c.Request().Context(), userID)
+			if err != nil {
+				if errors.Is(err, repository.ErrNotFound) {
+					return Challenge(c, http.StatusUnauthorized, "invalid_token", "the user no longer exists")
+				}
+				logger.Error("failed to fetch user", "error", err)
+				return c.JSON(http.StatusInternalServerError, map[string]string{
+					"error":   "internal_error",
+					"message": "failed to authorize request",
+				})
+			}
+
+			if !user.IsActive || !user.HasPermission(p) {
+				logger.Warn("permission denied", "user_id", user.ID, "permission", p, "path", c.Path())
+				return forbidden(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+func forbidden(c echo.Context) error {
+	return c.JSON(http.StatusForbidden, map[string]string{
+		"error":   "forbidden",
+		"message": "insufficient permissions",
+	})
+}
@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/ali/sso-server/internal/backchannel"
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/pkg/logger"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const browserSessionKey = "browser_session"
+
+// Sessions manages the browser (SSO) session: a cookie holding a random token
+// whose hash identifies a model.Session. It is what keeps a user signed in
+// across the server-rendered pages and authorization requests.
+type Sessions struct {
+	cfg     config.SessionConfig
+	repo    *repository.Repository
+	logouts *backchannel.Notifier
+}
+
+func NewSessions(cfg config.SessionConfig, repo *repository.Repository, logouts *backchannel.Notifier) *Sessions {
+	return &Sessions{
+		cfg:     cfg,
+		repo:    repo,
+		logouts: logouts,
+	}
+}
+
+// Load authenticates the request by its session cookie. A valid session
+// stores its principal and the session itself in the context; requests
+// without one pass through unauthenticated so the handler can send the user
+// to the login page.
+func (s *Sessions) Load() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cookie, err := c.Cookie(s.cfg.CookieName)
+			if err != nil || cookie.Value == "" {
+				return next(c)
+			}
+
+			session, err := s.find(c, cookie.Value)
+			if err != nil {
+				return c.String(http.StatusInternalServerError, "internal server error")
+			}
+			if session == nil {
+				s.clearCookie(c)
+				return next(c)
+			}
+
+			c.Set(browserSessionKey, session)
+			SetPrincipal(c, &Principal{
+				UserID:    session.UserID,
+				SessionID: session.ID,
+			})
+			return next(c)
+		}
+	}
+}
+
+// find returns the live session for a cookie token and an active user, or nil.
+// A non-nil error has been logged.
+func (s *Sessions) find(c echo.Context, token string) (*model.Session, error) {
+	ctx := c.Request().Context()
+
+	session, err := s.repo.Sessions.GetByCookieHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to fetch browser session", "error", err)
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+
+	user, err := s.repo.Users.GetByID(ctx, session.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, nil
+		}
+		logger.Error("failed to fetch user", "error", err)
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// Start stores a new browser session and sets its cookie. The caller fills in
+// the user and authentication context. The request's previous browser session
+// is always replaced, so a session ID planted before login cannot be carried
+// over (session fixation). When the same user signs in again, the client
+// sessions issued from it move to the new one; otherwise they end.
+func (s *Sessions) Start(c echo.Context, session *model.Session) error {
+	ctx := c.Request().Context()
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now().UTC()
+	session.ID = uuid.New()
+	session.CookieHash = hashToken(token)
+	session.UserAgent = c.Request().UserAgent()
+	session.IPAddress = c.RealIP()
+	session.ExpiresAt = now.Add(s.cfg.Lifetime)
+	session.CreatedAt = now
+	if err := s.repo.Sessions.Create(ctx, session); err != nil {
+		return err
+	}
+	c.SetCookie(s.cookie(token, session.ExpiresAt))
+
+	if previous, ok := BrowserSession(c); ok {
+		if previous.UserID == session.UserID {
+			if err := s.repo.Sessions.Reparent(ctx, previous.ID, session.ID); err != nil {
+				logger.Error("failed to move client sessions to new browser session", "error", err)
+			}
+		}
+		if err := s.end(ctx, previous); err != nil {
+			logger.Error("failed to end previous browser session", "error", err)
+		}
+	}
+	return nil
+}
+
+// End deletes the request's browser session, if any, and clears its cookie.
+// The client sessions issued from it end too, and their clients are notified.
+func (s *Sessions) End(c echo.Context) error {
+	s.clearCookie(c)
+
+	session, ok := BrowserSession(c)
+	if !ok {
+		return nil
+	}
+	return s.end(c.Request().Context(), session)
+}
+
+func (s *Sessions) end(ctx context.Context, session *model.Session) error {
+	children, err := s.repo.Sessions.DeleteByParentID(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+	s.logouts.SessionsEnded(ctx, children)
+
+	if err := s.repo.Sessions.Delete(ctx, session.ID); err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (s *Sessions) cookie(value string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     s.cfg.CookieName,
+		Value:    value,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   s.cfg.Secure,
+		HttpOnly: true,
+		// Lax still sends the cookie when a client redirects the user to
+		// /oauth/authorize, which Strict would not.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (s *Sessions) clearCookie(c echo.Context) {
+	cookie := s.cookie("", time.Unix(0, 0))
+	cookie.MaxAge = -1
+	c.SetCookie(cookie)
+}
+
+// BrowserSession returns the session loaded from the request's cookie, if any.
+func BrowserSession(c echo.Context) (*model.Session, bool) {
+	session, ok := c.Get(browserSessionKey).(*model.Session)
+	return session, ok && session != nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -7,11 +7,18 @@ import (
 )
 
 type AuthorizationCode struct {
-	Code        string    `json:"code"`
-	ClientID    uuid.UUID `json:"client_id"`
-	UserID      uuid.UUID `json:"user_id"`
-	RedirectURI string    `json:"redirect_uri"`
-	Scope       string    `json:"scope"`
-	ExpiresAt   time.Time `json:"expires_at"`
-	CreatedAt   time.Time `json:"created_at"`
+	Code                string        `json:"code"`
+	ClientID            uuid.UUID     `json:"client_id"`
+	UserID              uuid.UUID     `json:"user_id"`
+	SessionID           uuid.NullUUID `json:"session_id"`
+	RedirectURI         string        `json:"redirect_uri"`
+	Scope               string        `json:"scope"`
+	Nonce               string        `json:"nonce,omitempty"`
+	AuthTime            time.Time     `json:"auth_time"`
+	AMR                 []string      `json:"amr"`
+	ACR                 string        `json:"acr,omitempty"`
+	CodeChallenge       string        `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string        `json:"code_challenge_method,omitempty"`
+	ExpiresAt           time.Time     `json:"expires_at"`
+	CreatedAt           time.Time     `json:"created_at"`
 }
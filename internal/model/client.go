@@ -1,28 +1,71 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	ClientTypeConfidential = "confidential"
+	ClientTypePublic       = "public"
+)
+
+// Token endpoint authentication methods (OpenID Connect Core, section 9).
+const (
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodClientSecretPost  = "client_secret_post"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+	AuthMethodNone              = "none"
+)
+
 type Client struct {
-	ID           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	Secret       string    `json:"-"`
-	RedirectURIs []string  `json:"redirect_uris"`
-	IsActive     bool      `json:"is_active"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID                      uuid.UUID  `json:"id"`
+	Name                    string     `json:"name"`
+	Type                    string     `json:"client_type"`
+	AuthMethod              string     `json:"token_endpoint_auth_method"`
+	SecretHash              string     `json:"-"`
+	PreviousSecretHash      string     `json:"-"`
+	PreviousSecretExpiresAt *time.Time `json:"-"`
+	JWKS                    string     `json:"jwks,omitempty"`
+	RedirectURIs            []string   `json:"redirect_uris"`
+	PostLogoutRedirectURIs  []string   `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI    string     `json:"backchannel_logout_uri,omitempty"`
+	AllowedScopes           []string   `json:"allowed_scopes"`
+	IsActive                bool       `json:"is_active"`
+	CreatedAt               time.Time  `json:"created_at"`
+}
+
+func (c *Client) IsPublic() bool {
+	return c.Type == ClientTypePublic
 }
 
 type CreateClientRequest struct {
-	Name         string   `json:"name" validate:"required"`
-	RedirectURIs []string `json:"redirect_uris" validate:"required,min=1"`
+	Name                   string          `json:"name" validate:"required"`
+	Type                   string          `json:"client_type,omitempty" validate:"omitempty,oneof=confidential public"`
+	AuthMethod             string          `json:"token_endpoint_auth_method,omitempty"`
+	JWKS                   json.RawMessage `json:"jwks,omitempty"`
+	RedirectURIs           []string        `json:"redirect_uris" validate:"required,min=1"`
+	PostLogoutRedirectURIs []string        `json:"post_logout_redirect_uris,omitempty"`
+	BackchannelLogoutURI   string          `json:"backchannel_logout_uri,omitempty"`
+	AllowedScopes          []string        `json:"allowed_scopes,omitempty"`
 }
 
 type ClientResponse struct {
-	ID           uuid.UUID `json:"id"`
-	Name         string    `json:"name"`
-	Secret       string    `json:"secret,omitempty"`
-	RedirectURIs []string  `json:"redirect_uris"`
+	ID                     uuid.UUID `json:"id"`
+	Name                   string    `json:"name"`
+	Type                   string    `json:"client_type"`
+	AuthMethod             string    `json:"token_endpoint_auth_method"`
+	Secret                 string    `json:"secret,omitempty"`
+	RedirectURIs           []string  `json:"redirect_uris"`
+	PostLogoutRedirectURIs []string  `json:"post_logout_redirect_uris"`
+	BackchannelLogoutURI   string    `json:"backchannel_logout_uri,omitempty"`
+	AllowedScopes          []string  `json:"allowed_scopes"`
+}
+
+type ClientSecretResponse struct {
+	ClientID                uuid.UUID  `json:"client_id"`
+	Secret                  string     `json:"secret"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
 }
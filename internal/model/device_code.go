@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+// DeviceCode is a pending device authorization (RFC 8628). Only a hash of the
+// device code is stored; the user code is what the user types in.
+type DeviceCode struct {
+	DeviceCodeHash string        `json:"-"`
+	UserCode       string        `json:"user_code"`
+	ClientID       uuid.UUID     `json:"client_id"`
+	Scope          string        `json:"scope"`
+	Status         string        `json:"status"`
+	UserID         uuid.NullUUID `json:"user_id"`
+	SessionID      uuid.NullUUID `json:"session_id"`
+	AuthTime       time.Time     `json:"auth_time"`
+	AMR            []string      `json:"amr"`
+	ACR            string        `json:"acr,omitempty"`
+	Interval       time.Duration `json:"interval"`
+	LastPolledAt   *time.Time    `json:"last_polled_at,omitempty"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Logout delivery states. Pending deliveries are retried until they succeed
+// or run out of attempts.
+const (
+	LogoutDeliveryPending   = "pending"
+	LogoutDeliveryDelivered = "delivered"
+	LogoutDeliveryFailed    = "failed"
+)
+
+// LogoutDelivery is a back-channel logout notification to a client, telling
+// it that the user's session with it has ended.
+type LogoutDelivery struct {
+	ID       uuid.UUID `json:"id"`
+	ClientID uuid.UUID `json:"client_id"`
+	UserID   uuid.UUID `json:"user_id"`
+	// SessionID is the ended session, sent to the client as sid.
+	SessionID     uuid.UUID `json:"session_id"`
+	URI           string    `json:"uri"`
+	Status        string    `json:"status"`
+	Attempts      int       `json:"attempts"`
+	LastError     string    `json:"last_error,omitempty"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
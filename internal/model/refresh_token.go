@@ -0,0 +1,16 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is one member of a session's refresh token family. Only the
+// newest token of a family has no RotatedAt.
+type RefreshToken struct {
+	TokenHash string     `json:"-"`
+	SessionID uuid.UUID  `json:"session_id"`
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
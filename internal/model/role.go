@@ -0,0 +1,40 @@
+package model
+
+import "slices"
+
+// RoleAdmin may manage OAuth clients.
+const RoleAdmin = "admin"
+
+// Permission is an action a route requires. Users hold permissions through
+// their roles; a user without roles holds none.
+type Permission string
+
+const (
+	PermissionClientsRead  Permission = "clients:read"
+	PermissionClientsWrite Permission = "clients:write"
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {PermissionClientsRead, PermissionClientsWrite},
+}
+
+// ValidRole reports whether role is known.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasRole reports whether the user was assigned role.
+func (u *User) HasRole(role string) bool {
+	return slices.Contains(u.Roles, role)
+}
+
+// HasPermission reports whether any of the user's roles grants p.
+func (u *User) HasPermission(p Permission) bool {
+	for _, role := range u.Roles {
+		if slices.Contains(rolePermissions[role], p) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,12 +6,28 @@ import (
 	"github.com/google/uuid"
 )
 
+// Authentication context class references (OIDC acr) recorded on sessions,
+// from weakest to strongest.
+const (
+	ACRPassword = "pwd"
+	ACRMFA      = "mfa"
+)
+
+// ACRValues lists the supported authentication context classes.
+var ACRValues = []string{ACRPassword, ACRMFA}
+
 type Session struct {
-	ID           uuid.UUID `json:"id"`
-	UserID       uuid.UUID `json:"user_id"`
-	RefreshToken string    `json:"-"`
-	UserAgent    string    `json:"user_agent"`
-	IPAddress    string    `json:"ip_address"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID         uuid.UUID     `json:"id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	ClientID   uuid.NullUUID `json:"client_id"`
+	ParentID   uuid.NullUUID `json:"parent_id"`
+	Scope      string        `json:"scope,omitempty"`
+	AuthTime   time.Time     `json:"auth_time"`
+	AMR        []string      `json:"amr"`
+	ACR        string        `json:"acr,omitempty"`
+	UserAgent  string        `json:"user_agent"`
+	IPAddress  string        `json:"ip_address"`
+	CookieHash string        `json:"-"`
+	ExpiresAt  time.Time     `json:"expires_at"`
+	CreatedAt  time.Time     `json:"created_at"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type SigningKey struct {
+	ID         string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey []byte    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	// ActivatesAt is when the key starts signing. Until then it is only
+	// published, so that verifiers know it before it is used.
+	ActivatesAt time.Time  `json:"activates_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ali/sso-server/internal/model"
+)
+
+type authCodeRepository struct {
+	*store
+}
+
+const authCodeColumns = `code, client_id, user_id, session_id, redirect_uri, scope, nonce, auth_time, amr, acr,
+	code_challenge, code_challenge_method, expires_at, created_at`
+
+func (r *authCodeRepository) Create(ctx context.Context, code *model.AuthorizationCode) error {
+	amr, err := encodeStrings(code.AMR)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx,
+		`INSERT INTO authorization_codes (`+authCodeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		code.Code, code.ClientID, code.UserID, code.SessionID, code.RedirectURI, code.Scope,
+		code.Nonce, code.AuthTime, amr, code.ACR,
+		code.CodeChallenge, code.CodeChallengeMethod, code.ExpiresAt, code.CreatedAt,
+	)
+	return err
+}
+
+func (r *authCodeRepository) Consume(ctx context.Context, code string) (*model.AuthorizationCode, error) {
+	var (
+		ac  model.AuthorizationCode
+		amr string
+	)
+	err := r.queryRow(ctx, `SELECT `+authCodeColumns+` FROM authorization_codes WHERE code = ?`, code).Scan(
+		&ac.Code, &ac.ClientID, &ac.UserID, &ac.SessionID, &ac.RedirectURI, &ac.Scope,
+		&ac.Nonce, &ac.AuthTime, &amr, &ac.ACR,
+		&ac.CodeChallenge, &ac.CodeChallengeMethod, &ac.ExpiresAt, &ac.CreatedAt,
+	)
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	if ac.AMR, err = decodeStrings(amr); err != nil {
+		return nil, err
+	}
+
+	// Only the caller whose delete succeeds may redeem the code.
+	res, err := r.exec(ctx, `DELETE FROM authorization_codes WHERE code = ?`, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := mustAffect(res); err != nil {
+		return nil, err
+	}
+	return &ac, nil
+}
@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/google/uuid"
+)
+
+type clientRepository struct {
+	*store
+}
+
+const clientColumns = `id, name, client_type, token_endpoint_auth_method, secret_hash, previous_secret_hash, previous_secret_expires_at, jwks, redirect_uris, post_logout_redirect_uris, backchannel_logout_uri, allowed_scopes, is_active, created_at`
+
+func (r *clientRepository) Create(ctx context.Context, client *model.Client) error {
+	redirectURIs, err := encodeStrings(client.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	postLogoutRedirectURIs, err := encodeStrings(client.PostLogoutRedirectURIs)
+	if err != nil {
+		return err
+	}
+	allowedScopes, err := encodeStrings(client.AllowedScopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx,
+		`INSERT INTO clients (`+clientColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		client.ID, client.Name, client.Type, client.AuthMethod, client.SecretHash, client.PreviousSecretHash, client.PreviousSecretExpiresAt, client.JWKS, redirectURIs, postLogoutRedirectURIs, client.BackchannelLogoutURI, allowedScopes, client.IsActive, client.CreatedAt,
+	)
+	return err
+}
+
+func (r *clientRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Client, error) {
+	client, err := scanClient(r.queryRow(ctx, `SELECT `+clientColumns+` FROM clients WHERE id = ?`, id))
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	return client, nil
+}
+
+func (r *clientRepository) List(ctx context.Context) ([]model.Client, error) {
+	rows, err := r.query(ctx, `SELECT `+clientColumns+` FROM clients ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []model.Client{}
+	for rows.Next() {
+		client, err := scanClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+func (r *clientRepository) UpdateSecret(ctx context.Context, client *model.Client) error {
+	res, err := r.exec(ctx,
+		`UPDATE clients SET secret_hash = ?, previous_secret_hash = ?, previous_secret_expires_at = ? WHERE id = ?`,
+		client.SecretHash, client.PreviousSecretHash, client.PreviousSecretExpiresAt, client.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *clientRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := r.exec(ctx, `DELETE FROM clients WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func scanClient(row scanner) (*model.Client, error) {
+	var (
+		c                      model.Client
+		redirectURIs           string
+		postLogoutRedirectURIs string
+		allowedScopes          string
+	)
+	if err := row.Scan(&c.ID, &c.Name, &c.Type, &c.AuthMethod, &c.SecretHash, &c.PreviousSecretHash, &c.PreviousSecretExpiresAt, &c.JWKS, &redirectURIs, &postLogoutRedirectURIs, &c.BackchannelLogoutURI, &allowedScopes, &c.IsActive, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if c.RedirectURIs, err = decodeStrings(redirectURIs); err != nil {
+		return nil, err
+	}
+	if c.PostLogoutRedirectURIs, err = decodeStrings(postLogoutRedirectURIs); err != nil {
+		return nil, err
+	}
+	if c.AllowedScopes, err = decodeStrings(allowedScopes); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type clientAssertionRepository struct {
+	*store
+}
+
+func (r *clientAssertionRepository) Use(ctx context.Context, clientID uuid.UUID, jti string, expiresAt time.Time) error {
+	_, err := r.exec(ctx,
+		`INSERT INTO client_assertions (client_id, jti, expires_at) VALUES (?, ?, ?)`,
+		clientID, jti, expiresAt,
+	)
+	return err
+}
+
+func (r *clientAssertionRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := r.exec(ctx, `DELETE FROM client_assertions WHERE expires_at < ?`, before)
+	return err
+}
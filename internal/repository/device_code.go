@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+)
+
+type deviceCodeRepository struct {
+	*store
+}
+
+const deviceCodeColumns = `device_code_hash, user_code, client_id, scope, status, user_id, session_id, auth_time, amr, acr,
+	poll_interval, last_polled_at, expires_at, created_at`
+
+func (r *deviceCodeRepository) Create(ctx context.Context, dc *model.DeviceCode) error {
+	amr, err := encodeStrings(dc.AMR)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx,
+		`INSERT INTO device_codes (`+deviceCodeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		dc.DeviceCodeHash, dc.UserCode, dc.ClientID, dc.Scope, dc.Status, dc.UserID, dc.SessionID, nullTime(dc.AuthTime), amr, dc.ACR,
+		int(dc.Interval.Seconds()), dc.LastPolledAt, dc.ExpiresAt, dc.CreatedAt,
+	)
+	return err
+}
+
+func (r *deviceCodeRepository) GetByDeviceCodeHash(ctx context.Context, hash string) (*model.DeviceCode, error) {
+	dc, err := scanDeviceCode(r.queryRow(ctx, `SELECT `+deviceCodeColumns+` FROM device_codes WHERE device_code_hash = ?`, hash))
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	return dc, nil
+}
+
+func (r *deviceCodeRepository) GetByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error) {
+	dc, err := scanDeviceCode(r.queryRow(ctx, `SELECT `+deviceCodeColumns+` FROM device_codes WHERE user_code = ?`, userCode))
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	return dc, nil
+}
+
+func (r *deviceCodeRepository) Decide(ctx context.Context, dc *model.DeviceCode) error {
+	amr, err := encodeStrings(dc.AMR)
+	if err != nil {
+		return err
+	}
+
+	// Only a pending request can be approved or denied, and only once.
+	res, err := r.exec(ctx,
+		`UPDATE device_codes SET status = ?, user_id = ?, session_id = ?, auth_time = ?, amr = ?, acr = ?
+		WHERE device_code_hash = ? AND status = ?`,
+		dc.Status, dc.UserID, dc.SessionID, nullTime(dc.AuthTime), amr, dc.ACR, dc.DeviceCodeHash, model.DeviceCodePending,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *deviceCodeRepository) UpdatePoll(ctx context.Context, dc *model.DeviceCode) error {
+	res, err := r.exec(ctx,
+		`UPDATE device_codes SET poll_interval = ?, last_polled_at = ? WHERE device_code_hash = ?`,
+		int(dc.Interval.Seconds()), dc.LastPolledAt, dc.DeviceCodeHash,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *deviceCodeRepository) Delete(ctx context.Context, hash string) error {
+	res, err := r.exec(ctx, `DELETE FROM device_codes WHERE device_code_hash = ?`, hash)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func scanDeviceCode(row scanner) (*model.DeviceCode, error) {
+	var (
+		dc       model.DeviceCode
+		authTime sql.NullTime
+		amr      string
+		interval int
+	)
+	err := row.Scan(
+		&dc.DeviceCodeHash, &dc.UserCode, &dc.ClientID, &dc.Scope, &dc.Status, &dc.UserID, &dc.SessionID, &authTime, &amr, &dc.ACR,
+		&interval, &dc.LastPolledAt, &dc.ExpiresAt, &dc.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	dc.AuthTime = authTime.Time
+	dc.Interval = time.Duration(interval) * time.Second
+	if dc.AMR, err = decodeStrings(amr); err != nil {
+		return nil, err
+	}
+	return &dc, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/google/uuid"
+)
+
+type grantRepository struct {
+	*store
+}
+
+const grantColumns = `user_id, client_id, scopes, created_at, updated_at`
+
+func (r *grantRepository) Get(ctx context.Context, userID, clientID uuid.UUID) (*model.Grant, error) {
+	return scanGrant(r.queryRow(ctx,
+		`SELECT `+grantColumns+` FROM grants WHERE user_id = ? AND client_id = ?`, userID, clientID))
+}
+
+func (r *grantRepository) ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Grant, error) {
+	rows, err := r.query(ctx, `SELECT `+grantColumns+` FROM grants WHERE user_id = ? ORDER BY created_at`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []model.Grant{}
+	for rows.Next() {
+		grant, err := scanGrant(rows)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, *grant)
+	}
+	return grants, rows.Err()
+}
+
+func (r *grantRepository) Save(ctx context.Context, grant *model.Grant) error {
+	scopes, err := encodeStrings(grant.Scopes)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx,
+		`INSERT INTO grants (`+grantColumns+`) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, client_id) DO UPDATE SET scopes = excluded.scopes, updated_at = excluded.updated_at`,
+		grant.UserID, grant.ClientID, scopes, grant.CreatedAt, grant.UpdatedAt,
+	)
+	return err
+}
+
+func (r *grantRepository) Delete(ctx context.Context, userID, clientID uuid.UUID) error {
+	res, err := r.exec(ctx, `DELETE FROM grants WHERE user_id = ? AND client_id = ?`, userID, clientID)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func scanGrant(row scanner) (*model.Grant, error) {
+	var (
+		g      model.Grant
+		scopes string
+	)
+	err := row.Scan(&g.UserID, &g.ClientID, &scopes, &g.CreatedAt, &g.UpdatedAt)
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	if g.Scopes, err = decodeStrings(scopes); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
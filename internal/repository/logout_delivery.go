@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/google/uuid"
+)
+
+type logoutDeliveryRepository struct {
+	*store
+}
+
+const logoutDeliveryColumns = `id, client_id, user_id, session_id, uri, status, attempts, last_error, next_attempt_at, created_at, updated_at`
+
+func (r *logoutDeliveryRepository) Create(ctx context.Context, d *model.LogoutDelivery) error {
+	_, err := r.exec(ctx,
+		`INSERT INTO logout_deliveries (`+logoutDeliveryColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.ID, d.ClientID, d.UserID, d.SessionID, d.URI, d.Status, d.Attempts, d.LastError,
+		d.NextAttemptAt, d.CreatedAt, d.UpdatedAt,
+	)
+	return err
+}
+
+func (r *logoutDeliveryRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.LogoutDelivery, error) {
+	// The outer conditions are checked again against rows another instance
+	// has claimed in the meantime, which no longer match.
+	return r.list(ctx,
+		`UPDATE logout_deliveries SET next_attempt_at = ?
+		WHERE status = ? AND next_attempt_at <= ? AND id IN (
+			SELECT id FROM logout_deliveries
+			WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ?
+		)
+		RETURNING `+logoutDeliveryColumns,
+		leaseUntil, model.LogoutDeliveryPending, now, model.LogoutDeliveryPending, now, limit,
+	)
+}
+
+func (r *logoutDeliveryRepository) ListByClientID(ctx context.Context, clientID uuid.UUID, limit int) ([]model.LogoutDelivery, error) {
+	return r.list(ctx,
+		`SELECT `+logoutDeliveryColumns+` FROM logout_deliveries
+		WHERE client_id = ? ORDER BY created_at DESC LIMIT ?`,
+		clientID, limit,
+	)
+}
+
+func (r *logoutDeliveryRepository) Update(ctx context.Context, d *model.LogoutDelivery) error {
+	res, err := r.exec(ctx,
+		`UPDATE logout_deliveries SET status = ?, attempts = ?, last_error = ?, next_attempt_at = ?, updated_at = ? WHERE id = ?`,
+		d.Status, d.Attempts, d.LastError, d.NextAttemptAt, d.UpdatedAt, d.ID,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *logoutDeliveryRepository) list(ctx context.Context, query string, args ...any) ([]model.LogoutDelivery, error) {
+	rows, err := r.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []model.LogoutDelivery{}
+	for rows.Next() {
+		d, err := scanLogoutDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, *d)
+	}
+	return deliveries, rows.Err()
+}
+
+func scanLogoutDelivery(row scanner) (*model.LogoutDelivery, error) {
+	var d model.LogoutDelivery
+	err := row.Scan(&d.ID, &d.ClientID, &d.UserID, &d.SessionID, &d.URI, &d.Status, &d.Attempts, &d.LastError,
+		&d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt)
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	return &d, nil
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+)
+
+type refreshTokenRepository struct {
+	*store
+}
+
+const refreshTokenColumns = `token_hash, session_id, rotated_at, created_at`
+
+func (r *refreshTokenRepository) Create(ctx context.Context, token *model.RefreshToken) error {
+	_, err := r.exec(ctx,
+		`INSERT INTO refresh_tokens (`+refreshTokenColumns+`) VALUES (?, ?, ?, ?)`,
+		token.TokenHash, token.SessionID, token.RotatedAt, token.CreatedAt,
+	)
+	return err
+}
+
+func (r *refreshTokenRepository) GetByHash(ctx context.Context, hash string) (*model.RefreshToken, error) {
+	var t model.RefreshToken
+	err := r.queryRow(ctx, `SELECT `+refreshTokenColumns+` FROM refresh_tokens WHERE token_hash = ?`, hash).Scan(
+		&t.TokenHash, &t.SessionID, &t.RotatedAt, &t.CreatedAt,
+	)
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	return &t, nil
+}
+
+func (r *refreshTokenRepository) MarkRotated(ctx context.Context, hash string, at time.Time) error {
+	res, err := r.exec(ctx,
+		`UPDATE refresh_tokens SET rotated_at = ? WHERE token_hash = ? AND rotated_at IS NULL`, at, hash,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
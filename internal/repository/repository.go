@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ali/sso-server/internal/database"
+	"github.com/ali/sso-server/internal/model"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrConflict = errors.New("record already exists")
+)
+
+type UserRepository interface {
+	Create(ctx context.Context, user *model.User) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+	// The setters below write only their own columns, so that concurrent
+	// changes to other parts of the user are kept.
+	UpdateName(ctx context.Context, id uuid.UUID, name string, at time.Time) error
+	UpdatePassword(ctx context.Context, id uuid.UUID, hash string, at time.Time) error
+	SetRoles(ctx context.Context, id uuid.UUID, roles []string, at time.Time) error
+	// EnrollTOTP stores a new, unconfirmed TOTP secret. It fails with
+	// ErrNotFound once TOTP is enabled.
+	EnrollTOTP(ctx context.Context, id uuid.UUID, secret string, at time.Time) error
+	// EnableTOTP confirms the enrolled secret. It fails with ErrNotFound if
+	// the secret has been replaced or TOTP is already enabled.
+	EnableTOTP(ctx context.Context, id uuid.UUID, secret string, at time.Time) error
+	DisableTOTP(ctx context.Context, id uuid.UUID, at time.Time) error
+	// CountTOTPAttempt records an attempt at a TOTP code before it is checked
+	// and returns the attempts since the last accepted code. It fails with
+	// ErrNotFound while TOTP is locked for the user.
+	CountTOTPAttempt(ctx context.Context, id uuid.UUID, now time.Time) (int, error)
+	// LockTOTP refuses TOTP attempts until the given time.
+	LockTOTP(ctx context.Context, id uuid.UUID, until time.Time) error
+	// UseTOTPStep records the time step of an accepted code and resets the
+	// attempts. It fails with ErrNotFound unless the step is later than the
+	// last accepted one, so that every code is accepted only once.
+	UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error
+}
+
+type ClientRepository interface {
+	Create(ctx context.Context, client *model.Client) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Client, error)
+	List(ctx context.Context) ([]model.Client, error)
+	// UpdateSecret stores a new secret hash together with the previous one and its expiry.
+	UpdateSecret(ctx context.Context, client *model.Client) error
+	Delete(ctx context.Context, id uuid.UUID) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error)
+	Delete(ctx context.Context, id uuid.UUID) error
+	DeleteByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error)
+	DeleteByUserIDExcept(ctx context.Context, userID, keepID uuid.UUID) ([]model.Session, error)
+	GetByCookieHash(ctx context.Context, hash string) (*model.Session, error)
+	DeleteByUserIDAndClientID(ctx context.Context, userID, clientID uuid.UUID) ([]model.Session, error)
+	DeleteByParentID(ctx context.Context, parentID uuid.UUID) ([]model.Session, error)
+	Reparent(ctx context.Context, fromID, toID uuid.UUID) error
+	UpdateAuthContext(ctx context.Context, id uuid.UUID, authTime time.Time, amr []string, acr string) error
+}
+
+// GrantRepository stores the scopes users have consented to per client.
+type GrantRepository interface {
+	Get(ctx context.Context, userID, clientID uuid.UUID) (*model.Grant, error)
+	ListByUserID(ctx context.Context, userID uuid.UUID) ([]model.Grant, error)
+	// Save creates the grant or replaces its scopes.
+	Save(ctx context.Context, grant *model.Grant) error
+	Delete(ctx context.Context, userID, clientID uuid.UUID) error
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *model.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (*model.RefreshToken, error)
+	// MarkRotated fails with ErrNotFound unless the token is still current,
+	// so only one of two concurrent refreshes can rotate it.
+	MarkRotated(ctx context.Context, hash string, at time.Time) error
+}
+
+type AuthCodeRepository interface {
+	Create(ctx context.Context, code *model.AuthorizationCode) error
+	// Consume fetches and deletes the code in one step so it can be redeemed only once.
+	Consume(ctx context.Context, code string) (*model.AuthorizationCode, error)
+}
+
+type DeviceCodeRepository interface {
+	Create(ctx context.Context, dc *model.DeviceCode) error
+	GetByDeviceCodeHash(ctx context.Context, hash string) (*model.DeviceCode, error)
+	GetByUserCode(ctx context.Context, userCode string) (*model.DeviceCode, error)
+	// Decide records the user's approval or denial of a pending request.
+	Decide(ctx context.Context, dc *model.DeviceCode) error
+	UpdatePoll(ctx context.Context, dc *model.DeviceCode) error
+	// Delete fails with ErrNotFound if the code is already gone, so that an
+	// approved code can be redeemed only once.
+	Delete(ctx context.Context, hash string) error
+}
+
+// RevokedTokenRepository is the denylist of revoked access tokens, keyed by jti.
+type RevokedTokenRepository interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// ClientAssertionRepository remembers the jti of every private_key_jwt
+// assertion until it expires.
+type ClientAssertionRepository interface {
+	// Use fails with ErrConflict if the client has already used the jti.
+	Use(ctx context.Context, clientID uuid.UUID, jti string, expiresAt time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
+
+// LogoutDeliveryRepository queues back-channel logout notifications and keeps
+// a log of their outcome.
+type LogoutDeliveryRepository interface {
+	Create(ctx context.Context, d *model.LogoutDelivery) error
+	// ClaimDue returns pending deliveries whose next attempt is due and moves
+	// their next attempt to leaseUntil in the same statement, so that no other
+	// instance claims them while they are being delivered. A claimed delivery
+	// that is never updated becomes due again once the lease runs out.
+	ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]model.LogoutDelivery, error)
+	// ListByClientID returns the client's deliveries, newest first.
+	ListByClientID(ctx context.Context, clientID uuid.UUID, limit int) ([]model.LogoutDelivery, error)
+	Update(ctx context.Context, d *model.LogoutDelivery) error
+}
+
+type SigningKeyRepository interface {
+	Create(ctx context.Context, key *model.SigningKey) error
+	// Activate makes the stored key active from at, even if it was retired,
+	// and retires every other unretired key in the same transaction, so that
+	// at most one key is ever active.
+	Activate(ctx context.Context, id string, at time.Time) error
+	List(ctx context.Context) ([]model.SigningKey, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// Repository groups the repositories backed by a single database.
+type Repository struct {
+	Users            UserRepository
+	Clients          ClientRepository
+	Sessions         SessionRepository
+	Grants           GrantRepository
+	RefreshTokens    RefreshTokenRepository
+	AuthCodes        AuthCodeRepository
+	DeviceCodes      DeviceCodeRepository
+	RevokedTokens    RevokedTokenRepository
+	SigningKeys      SigningKeyRepository
+	LogoutDeliveries LogoutDeliveryRepository
+	ClientAssertions ClientAssertionRepository
+}
+
+// New returns the repositories for the given database driver.
+func New(db *sql.DB, driver string) (*Repository, error) {
+	var d dialect
+	switch driver {
+	case database.DriverPostgres:
+		d = postgresDialect{}
+	case database.DriverSQLite:
+		d = sqliteDialect{}
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %q", driver)
+	}
+
+	s := &store{db: db, dialect: d}
+
+	return &Repository{
+		Users:            &userRepository{store: s},
+		Clients:          &clientRepository{store: s},
+		Sessions:         &sessionRepository{store: s},
+		Grants:           &grantRepository{store: s},
+		RefreshTokens:    &refreshTokenRepository{store: s},
+		AuthCodes:        &authCodeRepository{store: s},
+		DeviceCodes:      &deviceCodeRepository{store: s},
+		RevokedTokens:    &revokedTokenRepository{store: s},
+		SigningKeys:      &signingKeyRepository{store: s},
+		LogoutDeliveries: &logoutDeliveryRepository{store: s},
+		ClientAssertions: &clientAssertionRepository{store: s},
+	}, nil
+}
+
+// dialect captures the differences between the supported SQL backends.
+type dialect interface {
+	// rebind converts '?' placeholders into the backend's placeholder syntax.
+	rebind(query string) string
+	isUniqueViolation(err error) bool
+}
+
+type store struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+func (s *store) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	res, err := s.db.ExecContext(ctx, s.dialect.rebind(query), args...)
+	if err != nil && s.dialect.isUniqueViolation(err) {
+		return nil, ErrConflict
+	}
+	return res, err
+}
+
+func (s *store) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *store) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// mustAffect returns ErrNotFound when a write matched no rows.
+func mustAffect(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// encodeStrings stores string lists as JSON text, which both backends support.
+func encodeStrings(values []string) (string, error) {
+	if values == nil {
+		values = []string{}
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// nullString stores the empty string as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullTime stores the zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+func decodeStrings(raw string) ([]string, error) {
+	var values []string
+	if raw == "" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type revokedTokenRepository struct {
+	*store
+}
+
+func (r *revokedTokenRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := r.exec(ctx, `INSERT INTO revoked_tokens (jti, expires_at) VALUES (?, ?)`, jti, expiresAt)
+	if errors.Is(err, ErrConflict) {
+		// Already revoked.
+		return nil
+	}
+	return err
+}
+
+func (r *revokedTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var n int
+	if err := r.queryRow(ctx, `SELECT COUNT(*) FROM revoked_tokens WHERE jti = ?`, jti).Scan(&n); err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *revokedTokenRepository) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := r.exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < ?`, before)
+	return err
+}
@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/google/uuid"
+)
+
+type sessionRepository struct {
+	*store
+}
+
+const sessionColumns = `id, user_id, client_id, parent_id, scope, auth_time, amr, acr, user_agent, ip_address, cookie_hash, expires_at, created_at`
+
+func (r *sessionRepository) Create(ctx context.Context, session *model.Session) error {
+	amr, err := encodeStrings(session.AMR)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx,
+		`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.UserID, session.ClientID, session.ParentID, session.Scope,
+		session.AuthTime, amr, session.ACR, session.UserAgent, session.IPAddress,
+		nullString(session.CookieHash), session.ExpiresAt, session.CreatedAt,
+	)
+	return err
+}
+
+func (r *sessionRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.Session, error) {
+	return r.get(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE id = ?`, id)
+}
+
+func (r *sessionRepository) GetByCookieHash(ctx context.Context, hash string) (*model.Session, error) {
+	return r.get(ctx, `SELECT `+sessionColumns+` FROM sessions WHERE cookie_hash = ?`, hash)
+}
+
+// UpdateAuthContext records a new authentication of the session's user, such
+// as a second factor verified for step-up.
+func (r *sessionRepository) UpdateAuthContext(ctx context.Context, id uuid.UUID, authTime time.Time, amr []string, acr string) error {
+	encoded, err := encodeStrings(amr)
+	if err != nil {
+		return err
+	}
+
+	res, err := r.exec(ctx,
+		`UPDATE sessions SET auth_time = ?, amr = ?, acr = ? WHERE id = ?`,
+		authTime, encoded, acr, id,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *sessionRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	res, err := r.exec(ctx, `DELETE FROM sessions WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+// The bulk deletes return the sessions they removed, so their clients can be
+// told that the sessions ended.
+
+func (r *sessionRepository) DeleteByUserID(ctx context.Context, userID uuid.UUID) ([]model.Session, error) {
+	return r.deleteReturning(ctx, `user_id = ?`, userID)
+}
+
+func (r *sessionRepository) DeleteByUserIDExcept(ctx context.Context, userID, keepID uuid.UUID) ([]model.Session, error) {
+	return r.deleteReturning(ctx, `user_id = ? AND id <> ?`, userID, keepID)
+}
+
+func (r *sessionRepository) DeleteByUserIDAndClientID(ctx context.Context, userID, clientID uuid.UUID) ([]model.Session, error) {
+	return r.deleteReturning(ctx, `user_id = ? AND client_id = ?`, userID, clientID)
+}
+
+// DeleteByParentID ends the sessions issued from a browser session.
+func (r *sessionRepository) DeleteByParentID(ctx context.Context, parentID uuid.UUID) ([]model.Session, error) {
+	return r.deleteReturning(ctx, `parent_id = ?`, parentID)
+}
+
+// Reparent moves the sessions issued from one browser session to another.
+func (r *sessionRepository) Reparent(ctx context.Context, fromID, toID uuid.UUID) error {
+	_, err := r.exec(ctx, `UPDATE sessions SET parent_id = ? WHERE parent_id = ?`, toID, fromID)
+	return err
+}
+
+func (r *sessionRepository) deleteReturning(ctx context.Context, where string, args ...any) ([]model.Session, error) {
+	rows, err := r.query(ctx, `DELETE FROM sessions WHERE `+where+` RETURNING `+sessionColumns, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sessionRepository) get(ctx context.Context, query string, args ...any) (*model.Session, error) {
+	session, err := scanSession(r.queryRow(ctx, query, args...))
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	return session, nil
+}
+
+func scanSession(row scanner) (*model.Session, error) {
+	var (
+		s          model.Session
+		amr        string
+		cookieHash sql.NullString
+	)
+	err := row.Scan(
+		&s.ID, &s.UserID, &s.ClientID, &s.ParentID, &s.Scope,
+		&s.AuthTime, &amr, &s.ACR, &s.UserAgent, &s.IPAddress,
+		&cookieHash, &s.ExpiresAt, &s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if s.AMR, err = decodeStrings(amr); err != nil {
+		return nil, err
+	}
+	s.CookieHash = cookieHash.String
+	return &s, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+)
+
+type signingKeyRepository struct {
+	*store
+}
+
+const signingKeyColumns = `id, algorithm, private_key, created_at, activates_at, retired_at`
+
+func (r *signingKeyRepository) Create(ctx context.Context, key *model.SigningKey) error {
+	_, err := r.exec(ctx,
+		`INSERT INTO signing_keys (`+signingKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Algorithm, key.PrivateKey, key.CreatedAt, key.ActivatesAt, key.RetiredAt,
+	)
+	return err
+}
+
+func (r *signingKeyRepository) Activate(ctx context.Context, id string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		r.dialect.rebind(`UPDATE signing_keys SET retired_at = ? WHERE retired_at IS NULL AND id <> ?`),
+		at, id,
+	); err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx,
+		r.dialect.rebind(`UPDATE signing_keys SET retired_at = NULL, activates_at = ? WHERE id = ?`),
+		at, id,
+	)
+	if err != nil {
+		return err
+	}
+	if err := mustAffect(res); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *signingKeyRepository) List(ctx context.Context) ([]model.SigningKey, error) {
+	rows, err := r.query(ctx, `SELECT `+signingKeyColumns+` FROM signing_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.SigningKey{}
+	for rows.Next() {
+		var k model.SigningKey
+		if err := rows.Scan(&k.ID, &k.Algorithm, &k.PrivateKey, &k.CreatedAt, &k.ActivatesAt, &k.RetiredAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (r *signingKeyRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.exec(ctx, `DELETE FROM signing_keys WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
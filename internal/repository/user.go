@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/ali/sso-server/internal/model"
+	"github.com/google/uuid"
+)
+
+type userRepository struct {
+	*store
+}
+
+const userColumns = `id, email, password_hash, name, roles, totp_secret, totp_enabled, is_active, created_at, updated_at`
+
+func (r *userRepository) Create(ctx context.Context, user *model.User) error {
+	roles, err := encodeStrings(user.Roles)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.exec(ctx,
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID, user.Email, user.PasswordHash, user.Name, roles, nullString(user.TOTPSecret), user.TOTPEnabled,
+		user.IsActive, user.CreatedAt, user.UpdatedAt,
+	)
+	return err
+}
+
+func (r *userRepository) GetByID(ctx context.Context, id uuid.UUID) (*model.User, error) {
+	return r.get(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.get(ctx, `SELECT `+userColumns+` FROM users WHERE email = ?`, email)
+}
+
+func (r *userRepository) UpdateName(ctx context.Context, id uuid.UUID, name string, at time.Time) error {
+	res, err := r.exec(ctx, `UPDATE users SET name = ?, updated_at = ? WHERE id = ?`, name, at, id)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id uuid.UUID, hash string, at time.Time) error {
+	res, err := r.exec(ctx, `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`, hash, at, id)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) SetRoles(ctx context.Context, id uuid.UUID, roles []string, at time.Time) error {
+	encoded, err := encodeStrings(roles)
+	if err != nil {
+		return err
+	}
+	res, err := r.exec(ctx, `UPDATE users SET roles = ?, updated_at = ? WHERE id = ?`, encoded, at, id)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) EnrollTOTP(ctx context.Context, id uuid.UUID, secret string, at time.Time) error {
+	res, err := r.exec(ctx,
+		`UPDATE users SET totp_secret = ?, updated_at = ? WHERE id = ? AND totp_enabled = ?`,
+		secret, at, id, false,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) EnableTOTP(ctx context.Context, id uuid.UUID, secret string, at time.Time) error {
+	res, err := r.exec(ctx,
+		`UPDATE users SET totp_enabled = ?, updated_at = ? WHERE id = ? AND totp_secret = ? AND totp_enabled = ?`,
+		true, at, id, secret, false,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) DisableTOTP(ctx context.Context, id uuid.UUID, at time.Time) error {
+	res, err := r.exec(ctx,
+		`UPDATE users SET totp_secret = NULL, totp_enabled = ?, updated_at = ? WHERE id = ?`,
+		false, at, id,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) CountTOTPAttempt(ctx context.Context, id uuid.UUID, now time.Time) (int, error) {
+	var attempts int
+	err := r.queryRow(ctx,
+		`UPDATE users SET totp_failed_attempts = totp_failed_attempts + 1
+		WHERE id = ? AND (totp_locked_until IS NULL OR totp_locked_until <= ?)
+		RETURNING totp_failed_attempts`,
+		id, now,
+	).Scan(&attempts)
+	if err != nil {
+		return 0, scanErr(err)
+	}
+	return attempts, nil
+}
+
+func (r *userRepository) LockTOTP(ctx context.Context, id uuid.UUID, until time.Time) error {
+	res, err := r.exec(ctx,
+		`UPDATE users SET totp_locked_until = ?, totp_failed_attempts = 0 WHERE id = ?`,
+		until, id,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) UseTOTPStep(ctx context.Context, id uuid.UUID, step int64) error {
+	res, err := r.exec(ctx,
+		`UPDATE users SET totp_last_step = ?, totp_failed_attempts = 0, totp_locked_until = NULL
+		WHERE id = ? AND totp_last_step < ?`,
+		step, id, step,
+	)
+	if err != nil {
+		return err
+	}
+	return mustAffect(res)
+}
+
+func (r *userRepository) get(ctx context.Context, query string, args ...any) (*model.User, error) {
+	var (
+		u          model.User
+		roles      string
+		totpSecret sql.NullString
+	)
+	err := r.queryRow(ctx, query, args...).Scan(
+		&u.ID, &u.Email, &u.PasswordHash, &u.Name, &roles, &totpSecret, &u.TOTPEnabled, &u.IsActive, &u.CreatedAt, &u.UpdatedAt,
+	)
+	if err != nil {
+		return nil, scanErr(err)
+	}
+	u.TOTPSecret = totpSecret.String
+	if u.Roles, err = decodeStrings(roles); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
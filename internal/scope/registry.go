@@ -0,0 +1,134 @@
+// Package scope holds the registry of OAuth scopes the server will grant.
+package scope
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ali/sso-server/internal/config"
+)
+
+// Built-in OpenID Connect scopes.
+const (
+	OpenID  = "openid"
+	Profile = "profile"
+	Email   = "email"
+)
+
+// Account is carried only by first-party tokens from /api/v1/auth/login and
+// gates the account management API. It is deliberately not registered, so
+// no client can be allowed it or request it.
+const Account = "account"
+
+type Scope struct {
+	Name        string
+	Description string
+	// OIDC scopes release user claims. They only make sense when a user is
+	// present, so clients cannot request them for themselves.
+	OIDC bool
+}
+
+var builtin = []Scope{
+	{Name: OpenID, Description: "Sign you in with your account", OIDC: true},
+	{Name: Profile, Description: "View your name", OIDC: true},
+	{Name: Email, Description: "View your email address", OIDC: true},
+}
+
+// Registry is the set of scopes known to the server: the built-in OIDC scopes
+// followed by the custom API scopes from the configuration.
+type Registry struct {
+	scopes []Scope
+	byName map[string]Scope
+}
+
+func NewRegistry(custom []config.ScopeConfig) (*Registry, error) {
+	r := &Registry{byName: make(map[string]Scope)}
+	for _, s := range builtin {
+		r.add(s)
+	}
+	for _, c := range custom {
+		if !ValidToken(c.Name) {
+			return nil, fmt.Errorf("invalid scope name: %q", c.Name)
+		}
+		if c.Name == Account {
+			return nil, fmt.Errorf("reserved scope: %q", c.Name)
+		}
+		if _, ok := r.byName[c.Name]; ok {
+			return nil, fmt.Errorf("duplicate scope: %q", c.Name)
+		}
+		r.add(Scope{Name: c.Name, Description: c.Description})
+	}
+	return r, nil
+}
+
+func (r *Registry) add(s Scope) {
+	r.scopes = append(r.scopes, s)
+	r.byName[s.Name] = s
+}
+
+// Lookup returns the registered scope with the given name.
+func (r *Registry) Lookup(name string) (Scope, bool) {
+	s, ok := r.byName[name]
+	return s, ok
+}
+
+// Names returns every registered scope name in registration order.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.scopes))
+	for i, s := range r.scopes {
+		names[i] = s.Name
+	}
+	return names
+}
+
+// OIDCNames returns the built-in OIDC scope names. They are what a client is
+// allowed when it is registered without explicit allowed scopes.
+func (r *Registry) OIDCNames() []string {
+	var names []string
+	for _, s := range r.scopes {
+		if s.OIDC {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// Describe returns the registered scopes among names, in the given order.
+// Unknown names are skipped.
+func (r *Registry) Describe(names []string) []Scope {
+	var scopes []Scope
+	for _, name := range names {
+		if s, ok := r.byName[name]; ok {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// Validate checks that every requested scope is registered and among allowed.
+// The error describes the first offending scope and is meant to be returned
+// to the client as an invalid_scope description.
+func (r *Registry) Validate(requested, allowed []string) error {
+	for _, name := range requested {
+		if _, ok := r.byName[name]; !ok {
+			return fmt.Errorf("unknown scope: %s", name)
+		}
+		if !slices.Contains(allowed, name) {
+			return fmt.Errorf("scope not allowed for this client: %s", name)
+		}
+	}
+	return nil
+}
+
+// ValidToken reports whether s is a valid scope-token (RFC 6749, section 3.3).
+func ValidToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 0x21 || r > 0x7e || r == '"' || r == '\\' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -11,19 +12,44 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/ali/sso-server/internal/backchannel"
 	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/database"
 	"github.com/ali/sso-server/internal/handler"
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/ali/sso-server/internal/repository"
+	"github.com/ali/sso-server/internal/scope"
+	"github.com/ali/sso-server/internal/token"
 	"github.com/ali/sso-server/pkg/logger"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
 type Server struct {
-	echo   *echo.Echo
-	config *config.Config
+	echo    *echo.Echo
+	config  *config.Config
+	db      *sql.DB
+	keys    *keys.Manager
+	logouts *backchannel.Notifier
 }
 
 func New(cfg *config.Config) (*Server, error) {
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkSchema(db, cfg.Database.Driver); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	repo, err := repository.New(db, cfg.Database.Driver)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	e := echo.New()
 	e.HideBanner = true
 
@@ -68,20 +94,78 @@ func New(cfg *config.Config) (*Server, error) {
 	}))
 
 	// Register handlers
-	h := handler.New()
+	keyManager, err := keys.NewManager(context.Background(), repo.SigningKeys, keys.Config{
+		Algorithm:        cfg.JWT.Algorithm,
+		KeyFile:          cfg.JWT.KeyFile,
+		RotationInterval: cfg.JWT.RotationInterval,
+		Retention:        cfg.JWT.KeyRetention,
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	tokens := token.NewService(cfg.JWT, keyManager)
+
+	scopes, err := scope.NewRegistry(cfg.OAuth.Scopes)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logouts := backchannel.NewNotifier(cfg.OAuth.BackchannelLogout, repo, tokens)
+
+	h := handler.New(cfg, repo, keyManager, tokens, scopes, logouts)
 	h.RegisterRoutes(e)
 
 	return &Server{
-		echo:   e,
-		config: cfg,
+		echo:    e,
+		config:  cfg,
+		db:      db,
+		keys:    keyManager,
+		logouts: logouts,
 	}, nil
 }
 
+// checkSchema refuses to start against a database that is behind the embedded migrations.
+func checkSchema(db *sql.DB, driver string) error {
+	m, err := database.NewMigrator(db, driver)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	version, dirty, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("database schema version %d is dirty; fix it and run `migrate force`", version)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("database schema is at version %d but %d is required; run `migrate up`", version, m.Latest())
+	}
+
+	return nil
+}
+
 func (s *Server) Start() error {
 	addr := fmt.Sprintf("%s:%s", s.config.Server.Host, s.config.Server.Port)
 
 	logger.Info("server starting", "address", addr)
 
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	go s.keys.Run(bgCtx)
+	go s.logouts.Run(bgCtx)
+
 	// Graceful shutdown
 	go func() {
 		if err := s.echo.Start(addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -98,7 +182,11 @@ func (s *Server) Start() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	return s.echo.Shutdown(ctx)
+	if err := s.echo.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	return s.db.Close()
 }
 
 func (s *Server) Echo() *echo.Echo {
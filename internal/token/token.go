@@ -0,0 +1,186 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ali/sso-server/internal/config"
+	"github.com/ali/sso-server/internal/keys"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// accessTokenType is the typ header of access tokens (RFC 9068, section 2.1).
+// ID and logout tokens are signed with the same keys and issuer, so the type
+// is what keeps them from being accepted as bearer tokens.
+const accessTokenType = "at+jwt"
+
+// Claims are the claims carried by access tokens.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope     string `json:"scope,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+}
+
+// verifiedClaims adds the claims that only other kinds of tokens carry, so
+// that VerifyAccessToken can reject them.
+type verifiedClaims struct {
+	Claims
+	AuthorizedParty string          `json:"azp,omitempty"`
+	Nonce           string          `json:"nonce,omitempty"`
+	Events          json.RawMessage `json:"events,omitempty"`
+}
+
+// AccessTokenParams describes the access token to issue.
+type AccessTokenParams struct {
+	Subject string
+	// Audience defaults to the configured audience when empty.
+	Audience  []string
+	Scope     string
+	SessionID uuid.UUID
+	ClientID  string
+}
+
+// Service issues and verifies signed access tokens.
+type Service struct {
+	keys          *keys.Manager
+	issuer        string
+	audience      []string
+	expiry        time.Duration
+	refreshExpiry time.Duration
+}
+
+func NewService(cfg config.JWTConfig, keyManager *keys.Manager) *Service {
+	audience := cfg.Audience
+	if len(audience) == 0 {
+		audience = []string{cfg.Issuer}
+	}
+
+	return &Service{
+		keys:          keyManager,
+		issuer:        cfg.Issuer,
+		audience:      audience,
+		expiry:        cfg.Expiry,
+		refreshExpiry: cfg.RefreshExpiry,
+	}
+}
+
+// Issuer returns the iss value placed in every token.
+func (s *Service) Issuer() string {
+	return s.issuer
+}
+
+// AccessTokenExpiry returns the lifetime of issued access tokens.
+func (s *Service) AccessTokenExpiry() time.Duration {
+	return s.expiry
+}
+
+// RefreshTokenExpiry returns the lifetime of refresh tokens.
+func (s *Service) RefreshTokenExpiry() time.Duration {
+	return s.refreshExpiry
+}
+
+// IssueAccessToken signs a new access token and returns it with its claims.
+func (s *Service) IssueAccessToken(p AccessTokenParams) (string, *Claims, error) {
+	now := time.Now()
+
+	audience := p.Audience
+	if len(audience) == 0 {
+		audience = s.audience
+	}
+
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.issuer,
+			Subject:   p.Subject,
+			Audience:  audience,
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.expiry)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+		Scope:    p.Scope,
+		ClientID: p.ClientID,
+	}
+	if p.SessionID != uuid.Nil {
+		claims.SessionID = p.SessionID.String()
+	}
+
+	signed, err := s.signWithType(claims, accessTokenType)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	return signed, claims, nil
+}
+
+// sign serializes claims as a JWS using the active signing key.
+func (s *Service) sign(claims jwt.Claims) (string, error) {
+	return s.signWithType(claims, "JWT")
+}
+
+// signWithType is sign with an explicit typ header, for tokens that must not
+// be mistaken for another kind signed with the same keys.
+func (s *Service) signWithType(claims jwt.Claims, typ string) (string, error) {
+	key := s.keys.SigningKey()
+	if key == nil {
+		return "", keys.ErrKeyNotFound
+	}
+
+	t := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	t.Header["kid"] = key.ID
+	t.Header["typ"] = typ
+
+	return t.SignedString(key.Signer)
+}
+
+// keyFunc resolves the verification key from the token's kid header.
+func (s *Service) keyFunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, err := s.keys.VerificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	if t.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("token alg %s does not match key alg %s", t.Method.Alg(), key.Algorithm)
+	}
+	return key.Public(), nil
+}
+
+// VerifyAccessToken checks the signature, type, issuer and expiry of an
+// access token. ID and logout tokens are rejected.
+func (s *Service) VerifyAccessToken(tokenString string) (*Claims, error) {
+	claims := &verifiedClaims{}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{keys.RS256, keys.ES256, keys.EdDSA}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+
+	t, err := parser.ParseWithClaims(tokenString, claims, s.keyFunc)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrExpiredToken
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if typ, _ := t.Header["typ"].(string); strings.TrimPrefix(strings.ToLower(typ), "application/") != accessTokenType {
+		return nil, fmt.Errorf("%w: unexpected token type %q", ErrInvalidToken, typ)
+	}
+	if claims.AuthorizedParty != "" || claims.Nonce != "" || len(claims.Events) > 0 {
+		return nil, fmt.Errorf("%w: not an access token", ErrInvalidToken)
+	}
+
+	return &claims.Claims, nil
+}